@@ -0,0 +1,390 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/simple"
+)
+
+// Authorizer decides if a request may use the admin handler. Requests are
+// rejected with 403 Forbidden and the error's message if it returns an
+// error.
+type Authorizer func(r *http.Request) error
+
+// Handler is an http.Handler that lets operators inspect and purge the caches
+// registered with it. Paths are relative to where the handler is mounted, so
+// it should be wrapped in http.StripPrefix when it is not at the root:
+//
+//	GET    /                            lists the caches with their stats
+//	GET    /{cache}                     describes a cache
+//	GET    /{cache}/keys                lists keys, with prefix, cursor and count parameters
+//	GET    /{cache}/keys/{key}          looks up a key without fetching it
+//	DELETE /{cache}/keys/{key}          deletes a key
+//	POST   /{cache}/invalidate?prefix=  deletes the keys that start with a prefix
+//	POST   /{cache}/invalidate?tag=     deletes the keys stored with a tag
+//
+// Responses are JSON. Operations that a cache does not support respond with
+// 501 Not Implemented. Every request is rejected with 403 Forbidden unless an
+// authorizer is configured with WithAuthorizer. Invalidating an empty prefix,
+// which deletes every key, must be confirmed with the all=true parameter.
+type Handler struct {
+	mu         sync.RWMutex
+	caches     map[string]yacache.Cache
+	authorizer Authorizer
+}
+
+// NewHandler returns a Handler without any caches. Every request is rejected
+// unless an authorizer is configured with WithAuthorizer.
+func NewHandler(options ...Option) *Handler {
+	handler := &Handler{
+		caches: make(map[string]yacache.Cache),
+	}
+
+	for _, option := range options {
+		option(handler)
+	}
+
+	return handler
+}
+
+// Register makes a cache available under a name, replacing any cache already
+// registered with the name.
+func (h *Handler) Register(name string, cache yacache.Cache) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.caches[name] = cache
+}
+
+// Unregister removes the cache registered with a name.
+func (h *Handler) Unregister(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.caches, name)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorizer == nil {
+		writeError(w, http.StatusForbidden, errors.New("no authorizer is configured"))
+		return
+	}
+	if err := h.authorizer(r); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		h.list(w, r)
+		return
+	}
+
+	name, rest, _ := strings.Cut(path, "/")
+	h.mu.RLock()
+	cache, ok := h.caches[name]
+	h.mu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("cache %q is not registered", name))
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, h.describe(r, name, cache))
+	case rest == "keys" && r.Method == http.MethodGet:
+		h.keys(w, r, cache)
+	case strings.HasPrefix(rest, "keys/") && r.Method == http.MethodGet:
+		h.lookup(w, r, cache, strings.TrimPrefix(rest, "keys/"))
+	case strings.HasPrefix(rest, "keys/") && r.Method == http.MethodDelete:
+		h.delete(w, r, cache, strings.TrimPrefix(rest, "keys/"))
+	case rest == "invalidate" && r.Method == http.MethodPost:
+		h.invalidate(w, r, cache)
+	case rest == "" || rest == "keys" || strings.HasPrefix(rest, "keys/") || rest == "invalidate":
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %q was not found", r.URL.Path))
+	}
+}
+
+// stats is the JSON form of yacache.Stats.
+type stats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+}
+
+// cacheInfo describes a registered cache. The stats and length are omitted
+// for caches that do not report them.
+type cacheInfo struct {
+	Name  string `json:"name"`
+	Stats *stats `json:"stats,omitempty"`
+	Len   *int   `json:"len,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	h.mu.RLock()
+	names := make([]string, 0, len(h.caches))
+	caches := make(map[string]yacache.Cache, len(h.caches))
+	for name, cache := range h.caches {
+		names = append(names, name)
+		caches[name] = cache
+	}
+	h.mu.RUnlock()
+	sort.Strings(names)
+
+	infos := make([]cacheInfo, len(names))
+	for i, name := range names {
+		infos[i] = h.describe(r, name, caches[name])
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (h *Handler) describe(r *http.Request, name string, cache yacache.Cache) cacheInfo {
+	info := cacheInfo{Name: name}
+	if reporter, ok := cache.(yacache.StatsReporter); ok {
+		s := reporter.Stats()
+		info.Stats = &stats{Hits: s.Hits, Misses: s.Misses, Evictions: s.Evictions, Expirations: s.Expirations}
+	}
+	if inspector, ok := cache.(yacache.Inspector); ok {
+		count, err := inspector.Len(r.Context())
+		if err == nil {
+			info.Len = &count
+		} else if !errors.Is(err, errors.ErrUnsupported) {
+			info.Error = err.Error()
+		}
+	}
+	return info
+}
+
+// keysPage is a page of the keys of a cache.
+type keysPage struct {
+	Keys   []string `json:"keys"`
+	Cursor string   `json:"cursor,omitempty"`
+}
+
+func (h *Handler) keys(w http.ResponseWriter, r *http.Request, cache yacache.Cache) {
+	inspector, ok := cache.(yacache.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the cache can not list keys"))
+		return
+	}
+
+	query := r.URL.Query()
+	count := 0
+	if value := query.Get("count"); value != "" {
+		var err error
+		if count, err = strconv.Atoi(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid count %q", value))
+			return
+		}
+	}
+
+	keys, cursor, err := inspector.Keys(r.Context(), query.Get("cursor"), query.Get("prefix"), count)
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, keysPage{Keys: keys, Cursor: cursor})
+}
+
+// itemInfo describes a cached item.
+type itemInfo struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Cached   time.Time   `json:"cached"`
+	Duration string      `json:"duration"`
+	Expires  time.Time   `json:"expires"`
+	Expired  bool        `json:"expired"`
+	Version  uint64      `json:"version,omitempty"`
+}
+
+// lookup describes the item cached for a key. The item is read with
+// PeekStale if the cache implements yacache.StalePeeker, so that items that
+// have expired but have not been removed are described, or with Peek if it
+// implements yacache.Peeker, so that looking it up does not change when it is
+// evicted.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request, cache yacache.Cache, key string) {
+	var (
+		item yacache.Item
+		ok   bool
+		err  error
+	)
+	if peeker, isPeeker := cache.(yacache.StalePeeker); isPeeker {
+		item, ok, err = peeker.PeekStale(r.Context(), simple.Key(key))
+	} else if peeker, isPeeker := cache.(yacache.Peeker); isPeeker {
+		item, ok, err = peeker.Peek(r.Context(), simple.Key(key))
+	} else {
+		item, ok, err = yacache.GetIfPresent(r.Context(), cache, simple.Key(key))
+	}
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("key %q is not cached", key))
+		return
+	}
+
+	info := itemInfo{
+		Key:      key,
+		Cached:   item.Cached(),
+		Duration: item.Duration().String(),
+		Expires:  item.Cached().Add(item.Duration()),
+		Expired:  item.Expired(),
+	}
+	if err := item.Error(); err != nil {
+		info.Error = err.Error()
+	} else {
+		info.Value = jsonValue(item.Value())
+	}
+	if versioned, ok := item.(yacache.Versioned); ok {
+		info.Version = versioned.Version()
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, cache yacache.Cache, key string) {
+	if err := cache.Delete(r.Context(), simple.Key(key)); err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidated is the number of items removed by an invalidation.
+type invalidated struct {
+	Removed int `json:"removed"`
+}
+
+// invalidate removes the keys stored with the tag parameter, using the
+// cache's yacache.TagInvalidator, or the keys that start with the prefix
+// parameter, using the cache's yacache.Inspector to find them. The keys are
+// deleted with yacache.ListedKeyDeleter if the cache implements it, as the
+// listed keys may not be the keys given to the cache. An empty prefix is only
+// accepted with the all parameter, as it removes every key.
+func (h *Handler) invalidate(w http.ResponseWriter, r *http.Request, cache yacache.Cache) {
+	query := r.URL.Query()
+	ctx := r.Context()
+
+	if query.Has("tag") {
+		h.invalidateTag(w, r, cache, query.Get("tag"))
+		return
+	}
+
+	prefix := query.Get("prefix")
+	if !query.Has("prefix") {
+		writeError(w, http.StatusBadRequest, errors.New("a prefix or tag parameter is required"))
+		return
+	}
+	if prefix == "" && query.Get("all") != "true" {
+		writeError(w, http.StatusBadRequest, errors.New("an empty prefix removes every key and requires all=true"))
+		return
+	}
+
+	inspector, ok := cache.(yacache.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the cache can not list keys"))
+		return
+	}
+
+	// The keys are listed before they are deleted so that deleting them does
+	// not change the pages being listed.
+	var keys []string
+	err := yacache.EachKey(ctx, inspector, prefix, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	deleteKey := func(key string) error {
+		return cache.Delete(ctx, simple.Key(key))
+	}
+	if deleter, ok := cache.(yacache.ListedKeyDeleter); ok {
+		deleteKey = func(key string) error {
+			return deleter.DeleteListedKey(ctx, key)
+		}
+	}
+	for i, key := range keys {
+		if err := deleteKey(key); err != nil {
+			writeJSON(w, http.StatusInternalServerError, struct {
+				invalidated
+				Error string `json:"error"`
+			}{invalidated{Removed: i}, err.Error()})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, invalidated{Removed: len(keys)})
+}
+
+func (h *Handler) invalidateTag(w http.ResponseWriter, r *http.Request, cache yacache.Cache, tag string) {
+	if tag == "" {
+		writeError(w, http.StatusBadRequest, errors.New("the tag parameter is empty"))
+		return
+	}
+	invalidator, ok := cache.(yacache.TagInvalidator)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("the cache does not support tags"))
+		return
+	}
+
+	removed, err := invalidator.InvalidateTag(r.Context(), tag)
+	if err != nil {
+		writeCacheError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, invalidated{Removed: removed})
+}
+
+// jsonValue returns a value if it can be encoded as JSON, and its default
+// format otherwise.
+func jsonValue(value interface{}) interface{} {
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return value
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// writeCacheError writes an error returned by a cache, which is 501 Not
+// Implemented for errors that wrap errors.ErrUnsupported.
+func writeCacheError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errors.ErrUnsupported) {
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
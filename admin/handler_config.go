@@ -0,0 +1,13 @@
+package admin
+
+// Option configures a Handler.
+type Option func(handler *Handler)
+
+// WithAuthorizer configures the function that decides if a request may use
+// the handler, such as by checking a token or the request's method. A Handler
+// without an authorizer rejects every request.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(handler *Handler) {
+		handler.authorizer = authorizer
+	}
+}
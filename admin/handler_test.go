@@ -0,0 +1,271 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/cachetest"
+	"github.com/ngerakines/yacache/simple"
+)
+
+// opaqueCache is a cache that does not implement any optional interfaces.
+type opaqueCache struct {
+	yacache.Cache
+}
+
+// allow is an authorizer that allows every request.
+func allow(r *http.Request) error {
+	return nil
+}
+
+func newCache(t *testing.T, keys ...string) yacache.Cache {
+	t.Helper()
+
+	c := simple.NewCache()
+	for _, key := range keys {
+		yacache.EnsureCacheSet(c, context.Background(), simple.Key(key), simple.NewCacheableValue("value of "+key, time.Hour))
+	}
+	return c
+}
+
+func request(t *testing.T, handler http.Handler, method, target string, result interface{}) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	if result != nil {
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("expected a JSON response but got %q", ct)
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+			t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestHandlerList(t *testing.T) {
+	handler := NewHandler(WithAuthorizer(allow))
+	users := newCache(t, "a", "b")
+	handler.Register("users", users)
+	handler.Register("pages", opaqueCache{newCache(t)})
+
+	yacache.EnsureCacheGet(users, context.Background(), simple.Key("a"), nil)
+
+	var infos []cacheInfo
+	if status := request(t, handler, http.MethodGet, "/", &infos); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if len(infos) != 2 || infos[0].Name != "pages" || infos[1].Name != "users" {
+		t.Fatalf("expected the caches sorted by name but got %+v", infos)
+	}
+	if infos[1].Len == nil || *infos[1].Len != 2 || infos[1].Stats == nil || infos[1].Stats.Hits != 1 {
+		t.Fatalf("unexpected cache info: %+v", infos[1])
+	}
+	if infos[0].Len != nil || infos[0].Stats != nil {
+		t.Fatalf("expected a cache without an inspector or stats to omit them: %+v", infos[0])
+	}
+
+	var info cacheInfo
+	if status := request(t, handler, http.MethodGet, "/users", &info); status != http.StatusOK || info.Name != "users" {
+		t.Fatalf("unexpected response %d: %+v", status, info)
+	}
+	if status := request(t, handler, http.MethodGet, "/missing", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown cache but got %d", status)
+	}
+}
+
+func TestHandlerKeys(t *testing.T) {
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", newCache(t, "user:1", "user:2", "user:3", "group:1"))
+
+	var page keysPage
+	request(t, handler, http.MethodGet, "/users/keys?prefix=user:&count=2", &page)
+	if strings.Join(page.Keys, ",") != "user:1,user:2" || page.Cursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	var last keysPage
+	request(t, handler, http.MethodGet, "/users/keys?prefix=user:&count=2&cursor="+page.Cursor, &last)
+	if strings.Join(last.Keys, ",") != "user:3" || last.Cursor != "" {
+		t.Fatalf("unexpected last page: %+v", last)
+	}
+
+	if status := request(t, handler, http.MethodGet, "/users/keys?count=many", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid count but got %d", status)
+	}
+}
+
+func TestHandlerLookup(t *testing.T) {
+	ctx := context.Background()
+	c := newCache(t, "users/1")
+	yacache.EnsureCacheSet(c, ctx, simple.Key("missing"), simple.NewCacheableError(errors.New("not found"), time.Minute))
+
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", c)
+
+	var item itemInfo
+	if status := request(t, handler, http.MethodGet, "/users/keys/users/1", &item); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if item.Key != "users/1" || item.Value != "value of users/1" || item.Duration != "1h0m0s" || item.Expired || item.Version == 0 {
+		t.Fatalf("unexpected item: %+v", item)
+	}
+	if !item.Expires.Equal(item.Cached.Add(time.Hour)) {
+		t.Fatalf("expected the item to expire an hour after it was cached: %+v", item)
+	}
+
+	var failed itemInfo
+	request(t, handler, http.MethodGet, "/users/keys/missing", &failed)
+	if failed.Error != "not found" || failed.Value != nil {
+		t.Fatalf("expected the cached error: %+v", failed)
+	}
+
+	if status := request(t, handler, http.MethodGet, "/users/keys/other", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a key that is not cached but got %d", status)
+	}
+}
+
+func TestHandlerLookupExpired(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	c := simple.NewCache(simple.WithClock(clock))
+	yacache.EnsureCacheSet(c, context.Background(), simple.Key("a"), simple.NewCacheableValue("value", time.Minute))
+	clock.Advance(time.Hour)
+
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", c)
+
+	var item itemInfo
+	if status := request(t, handler, http.MethodGet, "/users/keys/a", &item); status != http.StatusOK || !item.Expired {
+		t.Fatalf("expected the expired item to be described but got %d: %+v", status, item)
+	}
+}
+
+func TestHandlerDelete(t *testing.T) {
+	c := newCache(t, "a", "b")
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", c)
+
+	if status := request(t, handler, http.MethodDelete, "/users/keys/a", nil); status != http.StatusNoContent {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if yacache.EnsureCacheContains(c, context.Background(), simple.Key("a")) {
+		t.Fatal("expected the key to be deleted")
+	}
+	if status := request(t, handler, http.MethodPut, "/users/keys/b", nil); status != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 but got %d", status)
+	}
+}
+
+func TestHandlerInvalidate(t *testing.T) {
+	c := newCache(t, "user:1", "user:2", "group:1")
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", c)
+	handler.Register("opaque", opaqueCache{newCache(t, "a")})
+
+	var result invalidated
+	if status := request(t, handler, http.MethodPost, "/users/invalidate?prefix=user:", &result); status != http.StatusOK || result.Removed != 2 {
+		t.Fatalf("unexpected response %d: %+v", status, result)
+	}
+	if keys, _, _ := c.(yacache.Inspector).Keys(context.Background(), "", "", 0); strings.Join(keys, ",") != "group:1" {
+		t.Fatalf("expected only the keys with the prefix to be deleted but %v are left", keys)
+	}
+
+	if status := request(t, handler, http.MethodPost, "/opaque/invalidate?prefix=a", nil); status != http.StatusNotImplemented {
+		t.Fatalf("expected 501 for a cache that can not list keys but got %d", status)
+	}
+	if status := request(t, handler, http.MethodPost, "/users/invalidate", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a prefix but got %d", status)
+	}
+
+	tagged := newCache(t)
+	yacache.EnsureCacheSet(tagged, context.Background(), simple.Key("t1"), simple.NewTaggedCacheable(simple.NewCacheableValue("value", time.Hour), "premium"))
+	yacache.EnsureCacheSet(tagged, context.Background(), simple.Key("t2"), simple.NewCacheableValue("value", time.Hour))
+	handler.Register("tagged", tagged)
+	if status := request(t, handler, http.MethodPost, "/tagged/invalidate?tag=premium", &result); status != http.StatusOK || result.Removed != 1 {
+		t.Fatalf("unexpected response %d: %+v", status, result)
+	}
+	if keys, _, _ := tagged.(yacache.Inspector).Keys(context.Background(), "", "", 0); strings.Join(keys, ",") != "t2" {
+		t.Fatalf("expected only the tagged key to be deleted but %v are left", keys)
+	}
+	if status := request(t, handler, http.MethodPost, "/opaque/invalidate?tag=premium", nil); status != http.StatusNotImplemented {
+		t.Fatalf("expected 501 for a cache without tags but got %d", status)
+	}
+	if status := request(t, handler, http.MethodPost, "/tagged/invalidate?tag=", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty tag but got %d", status)
+	}
+
+	if status := request(t, handler, http.MethodPost, "/users/invalidate?prefix=", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty prefix without all=true but got %d", status)
+	}
+	if keys, _, _ := c.(yacache.Inspector).Keys(context.Background(), "", "", 0); len(keys) != 1 {
+		t.Fatalf("expected an unconfirmed empty prefix not to delete keys but %v are left", keys)
+	}
+	if status := request(t, handler, http.MethodPost, "/users/invalidate?prefix=&all=true", &result); status != http.StatusOK || result.Removed != 1 {
+		t.Fatalf("unexpected response %d: %+v", status, result)
+	}
+}
+
+// listedCache is a cache that lists its keys with a prefix, as a cache that
+// transforms keys does.
+type listedCache struct {
+	*simple.Cache
+}
+
+func (c listedCache) Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error) {
+	keys, next, err := c.Cache.Keys(ctx, cursor, strings.TrimPrefix(prefix, "x:"), count)
+	for i, key := range keys {
+		keys[i] = "x:" + key
+	}
+	return keys, next, err
+}
+
+func (c listedCache) DeleteListedKey(ctx context.Context, key string) error {
+	return c.Cache.Delete(ctx, simple.Key(strings.TrimPrefix(key, "x:")))
+}
+
+func TestHandlerInvalidateListedKeys(t *testing.T) {
+	c := newCache(t, "user:1", "user:2")
+	handler := NewHandler(WithAuthorizer(allow))
+	handler.Register("users", listedCache{c.(*simple.Cache)})
+
+	var result invalidated
+	if status := request(t, handler, http.MethodPost, "/users/invalidate?prefix=x:user:", &result); status != http.StatusOK || result.Removed != 2 {
+		t.Fatalf("unexpected response %d: %+v", status, result)
+	}
+	if count, _ := c.(yacache.Inspector).Len(context.Background()); count != 0 {
+		t.Fatalf("expected the listed keys to be deleted but %d are left", count)
+	}
+}
+
+func TestHandlerAuthorizer(t *testing.T) {
+	unauthorized := NewHandler()
+	unauthorized.Register("users", newCache(t, "a"))
+	if status := request(t, unauthorized, http.MethodGet, "/users/keys/a", nil); status != http.StatusForbidden {
+		t.Fatalf("expected requests to be forbidden without an authorizer but got %d", status)
+	}
+
+	handler := NewHandler(WithAuthorizer(func(r *http.Request) error {
+		if r.Method != http.MethodGet {
+			return errors.New("read only")
+		}
+		return nil
+	}))
+	handler.Register("users", newCache(t, "a"))
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if status := request(t, handler, http.MethodDelete, "/users/keys/a", &body); status != http.StatusForbidden || body.Error != "read only" {
+		t.Fatalf("expected the request to be forbidden but got %d: %+v", status, body)
+	}
+	if status := request(t, handler, http.MethodGet, "/users/keys/a", nil); status != http.StatusOK {
+		t.Fatalf("expected the request to be allowed but got %d", status)
+	}
+}
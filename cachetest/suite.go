@@ -0,0 +1,931 @@
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
+
+// Config describes how a Factory should configure a cache.
+type Config struct {
+	// MaxSize is the maximum number of items the cache should hold, or 0 if
+	// the size of the cache should not be limited.
+	MaxSize int
+
+	// EvictionCallback should be called by the cache when it evicts items to
+	// stay within MaxSize. It is nil if the test does not observe evictions.
+	EvictionCallback yacache.EvictionCallback
+
+	// ReplacementCallback should be called by the cache with the item that
+	// was replaced when an item is stored for a key that is already cached.
+	// It is nil if the test does not observe replacements.
+	ReplacementCallback yacache.EvictionCallback
+
+	// Clock is the clock the cache should use to record when items are
+	// cached and to decide if they have expired. Tests advance it rather
+	// than waiting for items to expire.
+	Clock *FakeClock
+}
+
+// Factory returns a new, empty cache configured as described by config. A
+// factory may return nil if the cache can not be configured as requested,
+// which skips the test.
+type Factory func(t *testing.T, config Config) yacache.Cache
+
+// key is the yacache.Key used by the conformance tests.
+type key string
+
+func (k key) Value() string {
+	return string(k)
+}
+
+type cacheable struct {
+	value    interface{}
+	err      error
+	duration time.Duration
+}
+
+func (c cacheable) Value() interface{} {
+	return c.value
+}
+
+func (c cacheable) Error() error {
+	return c.err
+}
+
+func (c cacheable) Duration() time.Duration {
+	return c.duration
+}
+
+// countingFetcher returns a fetcher that returns value for an hour and
+// counts how many times it has been called.
+func countingFetcher(value string) (yacache.Fetcher, func() int) {
+	var mu sync.Mutex
+	calls := 0
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return cacheable{value: value, duration: 1 * time.Hour}, nil
+	}
+	return fetcher, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls
+	}
+}
+
+// RunSuite runs the conformance tests for a yacache.Cache implementation.
+// Each test creates the caches it needs with the factory. Tests of optional
+// interfaces, such as yacache.Inspector, are skipped for caches that do not
+// implement them or that return an error matching errors.ErrUnsupported.
+func RunSuite(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, factory Factory)
+	}{
+		{"standard", testStandard},
+		{"get caches", testGetCaches},
+		{"expiry", testExpiry},
+		{"error caching", testErrorCaching},
+		{"fetcher errors not cached", testFetcherErrorsNotCached},
+		{"put overwrites", testPutOverwrites},
+		{"put fetcher error", testPutFetcherError},
+		{"delete", testDelete},
+		{"context cancellation", testContextCancellation},
+		{"cancelled context", testCancelledContext},
+		{"cancelled fetch not cached", testCancelledFetchNotCached},
+		{"lock wait cancellation", testLockWaitCancellation},
+		{"concurrency", testConcurrency},
+		{"eviction callback", testEvictionCallback},
+		{"inspector", testInspector},
+		{"peek", testPeek},
+		{"set", testSet},
+		{"conditional writes", testConditionalWrites},
+		{"conflicting writers", testConflictingWriters},
+		{"get if present", testGetIfPresent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, factory)
+		})
+	}
+}
+
+func newCache(t *testing.T, factory Factory, config Config) yacache.Cache {
+	t.Helper()
+
+	if config.Clock == nil {
+		config.Clock = NewFakeClock(time.Now())
+	}
+
+	c := factory(t, config)
+	if c == nil {
+		t.Skip("the cache can not be configured for this test")
+	}
+	return c
+}
+
+func testStandard(t *testing.T, factory Factory) {
+	fetcher, _ := countingFetcher("value")
+	Standard(t, newCache(t, factory, Config{}), key("foo"), key("bar"), fetcher)
+}
+
+func testGetCaches(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	fetcher, calls := countingFetcher("value")
+
+	for i := 0; i < 3; i++ {
+		item, err := c.Get(ctx, key("foo"), fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%s", item.Value()) != "value" {
+			t.Fatalf("unexpected value: %v", item.Value())
+		}
+		if item.Error() != nil {
+			t.Fatalf("unexpected error: %s", item.Error())
+		}
+		if item.Duration() != 1*time.Hour {
+			t.Fatalf("unexpected duration: %s", item.Duration())
+		}
+		if item.Expired() {
+			t.Fatal("item should not be expired")
+		}
+	}
+	if calls() != 1 {
+		t.Fatalf("expected the fetcher to be called once but it was called %d times", calls())
+	}
+}
+
+func testExpiry(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Now())
+	c := newCache(t, factory, Config{Clock: clock})
+
+	calls := 0
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		calls++
+		return cacheable{value: "value", duration: 1 * time.Minute}, nil
+	}
+
+	item, err := c.Get(ctx, key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !item.Cached().Equal(clock.Now()) {
+		t.Fatalf("expected the item to be cached at %s but got %s", clock.Now(), item.Cached())
+	}
+
+	clock.Advance(59 * time.Second)
+
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || !ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("item should be in the cache until it expires")
+	}
+
+	clock.Advance(2 * time.Second)
+
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("expired item should not be in the cache")
+	}
+
+	item, err = c.Get(ctx, key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected the fetcher to be called twice but it was called %d times", calls)
+	}
+	if !item.Cached().Equal(clock.Now()) {
+		t.Fatal("expected the item to be cached again")
+	}
+}
+
+func testErrorCaching(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+
+	calls := 0
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		calls++
+		return cacheable{err: errors.New("not found"), duration: 1 * time.Hour}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		item, err := c.Get(ctx, key("foo"), fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Error() == nil || item.Error().Error() != "not found" {
+			t.Fatalf("expected the cached error but got %v", item.Error())
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the fetcher to be called once but it was called %d times", calls)
+	}
+
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || !ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("cached error should be in the cache")
+	}
+}
+
+func testFetcherErrorsNotCached(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+
+	failure := errors.New("failure")
+	calls := 0
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		calls++
+		return nil, failure
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(ctx, key("foo"), fetcher); err != failure {
+			t.Fatalf("expected the fetcher error but got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected the fetcher to be called twice but it was called %d times", calls)
+	}
+
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("fetcher errors should not be in the cache")
+	}
+}
+
+func testPutOverwrites(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+
+	first, _ := countingFetcher("first")
+	second, _ := countingFetcher("second")
+	unused, calls := countingFetcher("unused")
+
+	if err := c.Put(ctx, key("foo"), first); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, key("foo"), second); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := c.Get(ctx, key("foo"), unused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%s", item.Value()) != "second" {
+		t.Fatalf("expected the second value but got %v", item.Value())
+	}
+	if calls() != 0 {
+		t.Fatal("expected the cached value to be used")
+	}
+}
+
+func testPutFetcherError(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+
+	fetcher, _ := countingFetcher("value")
+	failure := errors.New("failure")
+	failing := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		return nil, failure
+	}
+
+	if err := c.Put(ctx, key("foo"), failing); err != failure {
+		t.Fatalf("expected the fetcher error but got %v", err)
+	}
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("fetcher errors should not be in the cache")
+	}
+
+	if err := c.Put(ctx, key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, key("foo"), failing); err != failure {
+		t.Fatalf("expected the fetcher error but got %v", err)
+	}
+
+	item, err := c.Get(ctx, key("foo"), failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%s", item.Value()) != "value" {
+		t.Fatalf("expected the existing value to be kept but got %v", item.Value())
+	}
+}
+
+func testDelete(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	fetcher, calls := countingFetcher("value")
+
+	if err := c.Delete(ctx, key("missing")); err != nil {
+		t.Fatalf("deleting a missing key should not fail: %s", err)
+	}
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, key("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("deleted key should not be in the cache")
+	}
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if calls() != 2 {
+		t.Fatalf("expected the fetcher to be called twice but it was called %d times", calls())
+	}
+}
+
+func testContextCancellation(t *testing.T, factory Factory) {
+	c := newCache(t, factory, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != context.Canceled {
+		t.Fatalf("expected the context error but got %v", err)
+	}
+
+	if ok, err := c.Contains(context.Background(), key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("cancelled fetches should not be in the cache")
+	}
+}
+
+func testCancelledContext(t *testing.T, factory Factory) {
+	c := newCache(t, factory, Config{})
+	fetcher, calls := countingFetcher("value")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != context.Canceled {
+		t.Fatalf("expected get to return the context error but got %v", err)
+	}
+	if err := c.Put(ctx, key("foo"), fetcher); err != context.Canceled {
+		t.Fatalf("expected put to return the context error but got %v", err)
+	}
+	if _, err := c.Contains(ctx, key("foo")); err != context.Canceled {
+		t.Fatalf("expected contains to return the context error but got %v", err)
+	}
+	if err := c.Delete(ctx, key("foo")); err != context.Canceled {
+		t.Fatalf("expected delete to return the context error but got %v", err)
+	}
+	if calls() != 0 {
+		t.Fatal("the fetcher should not be called with a cancelled context")
+	}
+}
+
+func testCancelledFetchNotCached(t *testing.T, factory Factory) {
+	c := newCache(t, factory, Config{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		cancel()
+		return cacheable{value: "value", duration: 1 * time.Hour}, nil
+	}
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != context.Canceled {
+		t.Fatalf("expected get to return the context error but got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Put(ctx, key("bar"), fetcher); err != context.Canceled {
+		t.Fatalf("expected put to return the context error but got %v", err)
+	}
+
+	for _, k := range []key{"foo", "bar"} {
+		if ok, err := c.Contains(context.Background(), k); err != nil || ok {
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Fatalf("the result of a cancelled fetch for %s should not be cached", k)
+		}
+	}
+}
+
+// testLockWaitCancellation checks that a cache which blocks while another
+// item is being fetched stops waiting when the context is done.
+func testLockWaitCancellation(t *testing.T, factory Factory) {
+	c := newCache(t, factory, Config{})
+
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	slow := func(ctx context.Context, k yacache.Key) (yacache.Cacheable, error) {
+		close(fetching)
+		<-release
+		return cacheable{value: "value", duration: 1 * time.Hour}, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Get(context.Background(), key("slow"), slow)
+		done <- err
+	}()
+	<-fetching
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	fetcher, _ := countingFetcher("value")
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, key("foo"), fetcher)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil && err != context.DeadlineExceeded {
+			t.Fatalf("expected the context error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("get did not return after the context was done")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testConcurrency(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	fetcher, _ := countingFetcher("value")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				k := key(strconv.Itoa((i + j) % 5))
+				switch j % 4 {
+				case 0, 1:
+					item, err := c.Get(ctx, k, fetcher)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if fmt.Sprintf("%s", item.Value()) != "value" {
+						errs <- fmt.Errorf("unexpected value: %v", item.Value())
+						return
+					}
+				case 2:
+					if err := c.Put(ctx, k, fetcher); err != nil {
+						errs <- err
+						return
+					}
+				case 3:
+					if _, err := c.Contains(ctx, k); err != nil {
+						errs <- err
+						return
+					}
+					if err := c.Delete(ctx, k); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func testEvictionCallback(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	evictions := []string{}
+	evictionCB := func(k yacache.Key, item yacache.Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		evictions = append(evictions, k.Value())
+	}
+
+	c := newCache(t, factory, Config{MaxSize: 5, EvictionCallback: evictionCB})
+	fetcher, _ := countingFetcher("value")
+
+	for i := 0; i < 20; i++ {
+		if _, err := c.Get(ctx, key(strconv.Itoa(i)), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	present := 0
+	for i := 0; i < 20; i++ {
+		ok, err := c.Contains(ctx, key(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			present++
+		}
+	}
+	if present > 5 {
+		t.Fatalf("expected at most 5 items in the cache but there were %d", present)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evictions) != 20-present {
+		t.Fatalf("expected %d evictions but there were %d", 20-present, len(evictions))
+	}
+	for _, k := range evictions {
+		if ok, err := c.Contains(ctx, key(k)); err != nil || ok {
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Fatalf("evicted key %s should not be in the cache", k)
+		}
+	}
+}
+
+func testInspector(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	inspector, ok := c.(yacache.Inspector)
+	if !ok {
+		t.Skip("the cache does not implement yacache.Inspector")
+	}
+	if _, err := inspector.Len(ctx); errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+
+	fetcher, _ := countingFetcher("value")
+	stored := []string{"a:1", "a:2", "a:3", "b:1", "b:2"}
+	for _, k := range stored {
+		if _, err := c.Get(ctx, key(k), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size, err := inspector.Len(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != len(stored) {
+		t.Fatalf("expected %d items but there were %d", len(stored), size)
+	}
+
+	found := map[string]bool{}
+	cursor := ""
+	for {
+		keys, next, err := inspector.Keys(ctx, cursor, "a:", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			found[k] = true
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(found) != 3 || !found["a:1"] || !found["a:2"] || !found["a:3"] {
+		t.Fatalf("expected the keys starting with a: but got %v", found)
+	}
+
+	if err := inspector.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := inspector.Len(ctx); err != nil || size != 0 {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatalf("expected the cache to be empty after Clear but there were %d items", size)
+	}
+	if ok, err := c.Contains(ctx, key("b:1")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("cleared key should not be in the cache")
+	}
+}
+
+func testPeek(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Now())
+	c := newCache(t, factory, Config{Clock: clock})
+	peeker, ok := c.(yacache.Peeker)
+	if !ok {
+		t.Skip("the cache does not implement yacache.Peeker")
+	}
+	fetcher, calls := countingFetcher("value")
+
+	if _, ok, err := peeker.Peek(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("expected a missing key not to be found")
+	}
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("peeking should not fill the cache")
+	}
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	item, ok, err := peeker.Peek(ctx, key("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || fmt.Sprintf("%s", item.Value()) != "value" {
+		t.Fatalf("expected the cached item but got %v, %v", item, ok)
+	}
+	if calls() != 1 {
+		t.Fatalf("expected the fetcher to be called once but it was called %d times", calls())
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, ok, err := peeker.Peek(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("expected an expired item not to be found")
+	}
+}
+
+func testGetIfPresent(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	fetcher, _ := countingFetcher("value")
+
+	if _, ok, err := yacache.GetIfPresent(ctx, c, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("expected a missing key not to be found")
+	}
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("GetIfPresent should not fill the cache")
+	}
+
+	if _, err := c.Get(ctx, key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	item, ok, err := yacache.GetIfPresent(ctx, c, key("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || fmt.Sprintf("%s", item.Value()) != "value" {
+		t.Fatalf("expected the cached item but got %v, %v", item, ok)
+	}
+}
+
+func testSet(t *testing.T, factory Factory) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	evictions := 0
+	evictionCB := func(k yacache.Key, item yacache.Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		evictions++
+	}
+	replacements := []string{}
+	replacementCB := func(k yacache.Key, item yacache.Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		replacements = append(replacements, fmt.Sprintf("%s=%s", k.Value(), item.Value()))
+	}
+
+	c := newCache(t, factory, Config{MaxSize: 2, EvictionCallback: evictionCB, ReplacementCallback: replacementCB})
+	setter, ok := c.(yacache.Setter)
+	if !ok {
+		t.Skip("the cache does not implement yacache.Setter")
+	}
+	fetcher, calls := countingFetcher("fetched")
+
+	for _, value := range []string{"1", "2", "3"} {
+		if err := setter.Set(ctx, key("foo"), cacheable{value: value, duration: 1 * time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := setter.Set(ctx, key("bar"), cacheable{value: "1", duration: 1 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := c.Get(ctx, key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%s", item.Value()) != "3" {
+		t.Fatalf("expected the last value set but got %v", item.Value())
+	}
+	if calls() != 0 {
+		t.Fatalf("expected the fetcher not to be called but it was called %d times", calls())
+	}
+	if ok, err := c.Contains(ctx, key("bar")); err != nil || !ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("overwriting a key should not evict other keys")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if evictions != 0 {
+		t.Fatalf("expected no evictions but there were %d", evictions)
+	}
+	if fmt.Sprint(replacements) != "[foo=1 foo=2]" {
+		t.Fatalf("expected the replaced items to be reported but got %v", replacements)
+	}
+}
+
+// version returns the version of the item cached for a key.
+func version(t *testing.T, c yacache.Cache, k yacache.Key) (yacache.Item, uint64) {
+	t.Helper()
+
+	item, ok, err := yacache.GetIfPresent(context.Background(), c, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatalf("key '%s' should be in the cache but is not", k)
+	}
+	versioned, ok := item.(yacache.Versioned)
+	if !ok {
+		t.Fatalf("expected the item to implement yacache.Versioned but got %T", item)
+	}
+	return item, versioned.Version()
+}
+
+func testConditionalWrites(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	writer, ok := c.(yacache.ConditionalWriter)
+	if !ok {
+		t.Skip("the cache does not implement yacache.ConditionalWriter")
+	}
+
+	stored, err := writer.SetIfAbsent(ctx, key("foo"), cacheable{value: "1", duration: 1 * time.Hour})
+	if err != nil || !stored {
+		t.Fatalf("expected the value to be stored for a missing key: %v, %v", stored, err)
+	}
+	stored, err = writer.SetIfAbsent(ctx, key("foo"), cacheable{value: "2", duration: 1 * time.Hour})
+	if err != nil || stored {
+		t.Fatalf("expected the value not to be stored for a cached key: %v, %v", stored, err)
+	}
+
+	_, first := version(t, c, key("foo"))
+	stored, err = writer.SetIfVersion(ctx, key("foo"), cacheable{value: "3", duration: 1 * time.Hour}, first)
+	if err != nil || !stored {
+		t.Fatalf("expected the value to be stored for the current version: %v, %v", stored, err)
+	}
+	item, second := version(t, c, key("foo"))
+	if fmt.Sprintf("%s", item.Value()) != "3" || second == first {
+		t.Fatalf("expected a new value and version but got %v, %d", item.Value(), second)
+	}
+
+	stored, err = writer.SetIfVersion(ctx, key("foo"), cacheable{value: "4", duration: 1 * time.Hour}, first)
+	if err != nil || stored {
+		t.Fatalf("expected the value not to be stored for an old version: %v, %v", stored, err)
+	}
+	stored, err = writer.SetIfVersion(ctx, key("missing"), cacheable{value: "4", duration: 1 * time.Hour}, first)
+	if err != nil || stored {
+		t.Fatalf("expected the value not to be stored for a missing key: %v, %v", stored, err)
+	}
+
+	deleted, err := writer.DeleteIfVersion(ctx, key("foo"), first)
+	if err != nil || deleted {
+		t.Fatalf("expected the item not to be deleted for an old version: %v, %v", deleted, err)
+	}
+	deleted, err = writer.DeleteIfVersion(ctx, key("foo"), second)
+	if err != nil || !deleted {
+		t.Fatalf("expected the item to be deleted for the current version: %v, %v", deleted, err)
+	}
+	if ok, err := c.Contains(ctx, key("foo")); err != nil || ok {
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("deleted key should not be in the cache")
+	}
+}
+
+func testConflictingWriters(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	c := newCache(t, factory, Config{})
+	writer, ok := c.(yacache.ConditionalWriter)
+	if !ok {
+		t.Skip("the cache does not implement yacache.ConditionalWriter")
+	}
+
+	const writers = 5
+	const increments = 20
+
+	var wg sync.WaitGroup
+	created := make(chan bool, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stored, err := writer.SetIfAbsent(ctx, key("counter"), cacheable{value: "0", duration: 1 * time.Hour})
+			if err != nil {
+				t.Error(err)
+			}
+			created <- stored
+		}()
+	}
+	wg.Wait()
+	close(created)
+	creators := 0
+	for stored := range created {
+		if stored {
+			creators++
+		}
+	}
+	if creators != 1 {
+		t.Fatalf("expected exactly one writer to create the counter but %d did", creators)
+	}
+
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				for {
+					item, ok, err := yacache.GetIfPresent(ctx, c, key("counter"))
+					if err != nil || !ok {
+						errs <- fmt.Errorf("counter should be cached: %v", err)
+						return
+					}
+					n, err := strconv.Atoi(fmt.Sprintf("%v", item.Value()))
+					if err != nil {
+						errs <- err
+						return
+					}
+					stored, err := writer.SetIfVersion(ctx, key("counter"), cacheable{value: strconv.Itoa(n + 1), duration: 1 * time.Hour}, item.(yacache.Versioned).Version())
+					if err != nil {
+						errs <- err
+						return
+					}
+					if stored {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	item, _ := version(t, c, key("counter"))
+	if fmt.Sprintf("%v", item.Value()) != strconv.Itoa(writers*increments) {
+		t.Fatalf("expected every increment to be kept but the counter is %v", item.Value())
+	}
+}
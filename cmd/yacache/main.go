@@ -0,0 +1,363 @@
+// Command yacache inspects and manages caches stored in redis by the
+// yacache/redis package. It understands the hash layout of items, the
+// namespace and generation conventions of keys, and the index used to evict
+// items.
+//
+// Usage:
+//
+//	yacache [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	get <key>          show the item cached for a key
+//	inspect <key>      show the redis key, fields, expiration and index entry of an item
+//	delete <key>...    delete items
+//	keys [prefix]      list the keys of the namespace
+//	index [-limit n]   show the index in the order that items will be evicted
+//	size               show the number of items and index entries against the maximum size
+//	orphans [-remove]  find, or remove, index entries whose items no longer exist
+//	flush -yes         delete every item in the namespace
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/redis"
+	"github.com/ngerakines/yacache/simple"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// errUsage is returned when the command line is invalid.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr)
+	if err == nil {
+		return
+	}
+	// Flag errors and usage have already been written.
+	if err != errUsage {
+		fmt.Fprintln(os.Stderr, "yacache:", err)
+	}
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
+
+// options are the flags that configure the connection to redis and the cache.
+type options struct {
+	addrs       string
+	username    string
+	password    string
+	db          int
+	namespace   string
+	generations bool
+	maxSize     int64
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	var opts options
+	flags := flag.NewFlagSet("yacache", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.addrs, "addr", "localhost:6379", "comma separated redis addresses; several addresses connect to a cluster")
+	flags.StringVar(&opts.username, "username", "", "redis username")
+	flags.StringVar(&opts.password, "password", os.Getenv("REDIS_PASSWORD"), "redis password, defaulting to $REDIS_PASSWORD")
+	flags.IntVar(&opts.db, "db", 0, "redis database")
+	flags.StringVar(&opts.namespace, "namespace", "", "namespace of the cache, as given to redis.WithNamespace")
+	flags.BoolVar(&opts.generations, "generations", false, "the cache was created with redis.WithGenerations")
+	flags.Int64Var(&opts.maxSize, "max-size", -1, "maximum size of the cache, as given to redis.WithMaxSize")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: yacache [flags] get|inspect|delete|keys|index|size|orphans|flush [arguments]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	client := goredis.NewUniversalClient(&goredis.UniversalOptions{
+		Addrs:    strings.Split(opts.addrs, ","),
+		Username: opts.username,
+		Password: opts.password,
+		DB:       opts.db,
+	})
+	defer client.Close()
+
+	cacheOptions := []redis.CacheOption{redis.WithMaxSize(opts.maxSize)}
+	if opts.namespace != "" {
+		cacheOptions = append(cacheOptions, redis.WithNamespace(opts.namespace))
+	}
+	if opts.generations {
+		cacheOptions = append(cacheOptions, redis.WithGenerations())
+	}
+	cache := redis.NewCache(client, cacheOptions...).(*redis.Cache)
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "get":
+		return get(ctx, stdout, cache, args)
+	case "inspect":
+		return inspect(ctx, stdout, cache, args)
+	case "delete":
+		return remove(ctx, stdout, cache, args)
+	case "keys":
+		return keys(ctx, stdout, cache, args)
+	case "index":
+		return index(ctx, stdout, stderr, cache, args)
+	case "size":
+		return size(ctx, stdout, cache, args)
+	case "orphans":
+		return orphans(ctx, stdout, stderr, cache, args)
+	case "flush":
+		return flush(ctx, stdout, stderr, cache, args)
+	default:
+		fmt.Fprintf(stderr, "yacache: unknown command %q\n", command)
+		flags.Usage()
+		return errUsage
+	}
+}
+
+func get(ctx context.Context, stdout io.Writer, cache *redis.Cache, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: get takes a key", errUsage)
+	}
+
+	item, ok, err := cache.Peek(ctx, simple.Key(args[0]))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("key %q is not cached", args[0])
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "key\t%s\n", args[0])
+	if err := item.Error(); err != nil {
+		fmt.Fprintf(w, "error\t%s\n", err)
+	} else {
+		fmt.Fprintf(w, "value\t%v\n", item.Value())
+	}
+	fmt.Fprintf(w, "cached\t%s\n", formatTime(item.Cached()))
+	fmt.Fprintf(w, "duration\t%s\n", item.Duration())
+	fmt.Fprintf(w, "expires\t%s\n", formatTime(item.Cached().Add(item.Duration())))
+	if versioned, ok := item.(yacache.Versioned); ok {
+		fmt.Fprintf(w, "version\t%d\n", versioned.Version())
+	}
+	return w.Flush()
+}
+
+func inspect(ctx context.Context, stdout io.Writer, cache *redis.Cache, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: inspect takes a key", errUsage)
+	}
+
+	fields, ok, err := cache.Inspect(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("key %q is not stored", args[0])
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "redis key\t%s\n", fields.RedisKey)
+	if fields.TTL >= 0 {
+		fmt.Fprintf(w, "ttl\t%s\n", fields.TTL)
+	} else {
+		fmt.Fprintf(w, "ttl\tnone\n")
+	}
+	if fields.Indexed {
+		fmt.Fprintf(w, "index score\t%s\n", formatTime(fields.IndexScore))
+	} else {
+		fmt.Fprintf(w, "index score\tnot indexed\n")
+	}
+
+	fmt.Fprintln(w, "\nfield\tmeaning\tvalue")
+	for _, field := range []struct {
+		name, meaning, value string
+	}{
+		{"k", "key", fields.Key},
+		{"v", "value", fields.Value},
+		{"e", "error", fields.Error},
+		{"c", "cached", formatTime(fields.Cached)},
+		{"d", "duration", fields.Duration.String()},
+		{"f", "first cached", formatTime(fields.FirstCached)},
+		{"w", "window", fields.Window.String()},
+		{"n", "version", fmt.Sprint(fields.Version)},
+	} {
+		raw, ok := fields.Raw[field.name]
+		if !ok {
+			continue
+		}
+		if raw == field.value {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", field.name, field.meaning, field.value)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s (%s)\n", field.name, field.meaning, field.value, raw)
+		}
+	}
+	return w.Flush()
+}
+
+func remove(ctx context.Context, stdout io.Writer, cache *redis.Cache, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: delete takes one or more keys", errUsage)
+	}
+	for _, key := range args {
+		if err := cache.Delete(ctx, simple.Key(key)); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "deleted %s\n", key)
+	}
+	return nil
+}
+
+func keys(ctx context.Context, stdout io.Writer, cache *redis.Cache, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%w: keys takes an optional prefix", errUsage)
+	}
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	return yacache.EachKey(ctx, cache, prefix, func(key string) error {
+		_, err := fmt.Fprintln(stdout, key)
+		return err
+	})
+}
+
+func index(ctx context.Context, stdout, stderr io.Writer, cache *redis.Cache, args []string) error {
+	flags := flag.NewFlagSet("index", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	limit := flags.Int64("limit", 20, "number of entries to show, or 0 for every entry")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	entries, err := cache.Index(ctx, 0, *limit-1)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "position\tscore\tredis key")
+	for i, entry := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", i, formatTime(entry.Score), entry.Key)
+	}
+	return w.Flush()
+}
+
+func size(ctx context.Context, stdout io.Writer, cache *redis.Cache, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: size does not take arguments", errUsage)
+	}
+
+	indexed, err := cache.IndexLen(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	count, err := countItems(ctx, cache)
+	switch {
+	case errors.Is(err, redis.ErrNoNamespace):
+		fmt.Fprintf(w, "items\tunknown without a namespace\n")
+	case err != nil:
+		return err
+	default:
+		fmt.Fprintf(w, "items\t%d\n", count)
+	}
+	fmt.Fprintf(w, "index entries\t%d\n", indexed)
+	if maxSize := cache.MaxSize(); maxSize > 0 {
+		fmt.Fprintf(w, "max size\t%d\n", maxSize)
+		fmt.Fprintf(w, "used\t%.1f%%\n", float64(indexed)/float64(maxSize)*100)
+	} else {
+		fmt.Fprintf(w, "max size\tnone given\n")
+	}
+	return w.Flush()
+}
+
+// countItems scans the cache's namespace for the items that are stored,
+// rather than using Len, which counts the index entries of a cache with a
+// maximum size.
+func countItems(ctx context.Context, cache *redis.Cache) (int, error) {
+	count := 0
+	cursor := ""
+	for {
+		page, next, err := cache.Keys(ctx, cursor, "", 0)
+		if err != nil {
+			return 0, err
+		}
+		count += len(page)
+		if next == "" {
+			return count, nil
+		}
+		cursor = next
+	}
+}
+
+func orphans(ctx context.Context, stdout, stderr io.Writer, cache *redis.Cache, args []string) error {
+	flags := flag.NewFlagSet("orphans", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	remove := flags.Bool("remove", false, "remove the orphaned entries from the index")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	if *remove {
+		removed, err := cache.RemoveOrphans(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "removed %d orphaned index entries\n", removed)
+		return nil
+	}
+
+	entries, err := cache.Orphans(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(stdout, "%s\t%s\n", formatTime(entry.Score), entry.Key)
+	}
+	fmt.Fprintf(stdout, "%d orphaned index entries\n", len(entries))
+	return nil
+}
+
+func flush(ctx context.Context, stdout, stderr io.Writer, cache *redis.Cache, args []string) error {
+	flags := flag.NewFlagSet("flush", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	yes := flags.Bool("yes", false, "confirm that every item in the namespace should be deleted")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if !*yes {
+		return errors.New("flush deletes every item in the namespace; run it again with -yes to confirm")
+	}
+
+	if err := cache.Flush(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "flushed")
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
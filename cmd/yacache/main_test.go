@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/ngerakines/yacache/redis"
+	"github.com/ngerakines/yacache/simple"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// setup starts a fake redis with a namespaced cache holding items for keys.
+func setup(t *testing.T, keys ...string) (*miniredis.Miniredis, *goredis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	cache := redis.NewCache(client, redis.WithNamespace("users"), redis.WithMaxSize(10)).(*redis.Cache)
+	for _, key := range keys {
+		if err := cache.Set(context.Background(), simple.Key(key), simple.NewCacheableValue("value of "+key, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return server, client
+}
+
+func runCommand(t *testing.T, server *miniredis.Miniredis, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-addr", server.Addr(), "-namespace", "users", "-max-size", "10"}, args...)
+	err := run(context.Background(), args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+// containsLine returns true if out has a line with the fields.
+func containsLine(out string, fields []string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Join(strings.Fields(line), " ") == strings.Join(fields, " ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGet(t *testing.T) {
+	server, _ := setup(t, "alice")
+
+	out, err := runCommand(t, server, "get", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range [][]string{{"value", "value", "of", "alice"}, {"duration", "1h0m0s"}} {
+		if !containsLine(out, expected) {
+			t.Fatalf("expected a line with %v in:\n%s", expected, out)
+		}
+	}
+
+	if _, err := runCommand(t, server, "get", "bob"); err == nil {
+		t.Fatal("expected an error for a key that is not cached")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	server, _ := setup(t, "alice")
+
+	out, err := runCommand(t, server, "inspect", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "{users}:alice") {
+		t.Fatalf("expected the redis key in:\n%s", out)
+	}
+	for _, expected := range [][]string{{"v", "value", "value", "of", "alice"}, {"d", "duration", "1h0m0s"}, {"k", "key", "alice"}} {
+		if !containsLine(out, expected) {
+			t.Fatalf("expected a line with %v in:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "not indexed") {
+		t.Fatalf("expected the item to be indexed:\n%s", out)
+	}
+}
+
+func TestDeleteAndKeys(t *testing.T) {
+	server, _ := setup(t, "alice", "bob", "carol")
+
+	if _, err := runCommand(t, server, "delete", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runCommand(t, server, "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := strings.Fields(out)
+	if len(keys) != 2 || strings.Contains(out, "bob") {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestIndexSizeAndOrphans(t *testing.T) {
+	ctx := context.Background()
+	server, client := setup(t, "alice", "bob", "carol")
+
+	out, err := runCommand(t, server, "index", "-limit", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "{users}:alice") || strings.Contains(out, "{users}:bob") {
+		t.Fatalf("expected only the next item to be evicted:\n%s", out)
+	}
+
+	if err := client.Del(ctx, "{users}:bob").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = runCommand(t, server, "size")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range [][]string{{"items", "2"}, {"index", "entries", "3"}, {"max", "size", "10"}, {"used", "30.0%"}} {
+		if !containsLine(out, expected) {
+			t.Fatalf("expected a line with %v in:\n%s", expected, out)
+		}
+	}
+
+	out, err = runCommand(t, server, "orphans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "{users}:bob") || !strings.Contains(out, "1 orphaned index entries") {
+		t.Fatalf("expected bob to be an orphan:\n%s", out)
+	}
+
+	if _, err := runCommand(t, server, "orphans", "-remove"); err != nil {
+		t.Fatal(err)
+	}
+	if count := client.ZCard(ctx, "{users}:yacache:index").Val(); count != 2 {
+		t.Fatalf("expected 2 index entries after removing orphans but got %d", count)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	server, client := setup(t, "alice", "bob")
+
+	if _, err := runCommand(t, server, "flush"); err == nil {
+		t.Fatal("expected flush to require confirmation")
+	}
+	if _, err := runCommand(t, server, "flush", "-yes"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := client.Keys(context.Background(), "{users}:*").Val(); len(keys) != 0 {
+		t.Fatalf("expected the namespace to be flushed but found %v", keys)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	server, _ := setup(t)
+
+	for _, args := range [][]string{{}, {"unknown"}, {"get"}} {
+		var stdout, stderr bytes.Buffer
+		err := run(context.Background(), append([]string{"-addr", server.Addr()}, args...), &stdout, &stderr)
+		if !errors.Is(err, errUsage) {
+			t.Fatalf("expected a usage error for %v but got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,687 @@
+package disk
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/simple"
+	"go.etcd.io/bbolt"
+	"golang.org/x/sync/semaphore"
+)
+
+// writeLock is the weight of the cache's lock that is acquired to change the
+// cache. Reading the cache acquires a weight of 1.
+const writeLock = 1 << 30
+
+// touchBatchSize is the number of keys read without the cache being changed
+// after which the reads are written to the access index.
+const touchBatchSize = 256
+
+// DefaultBucket is the name of the bucket that items are stored in when one
+// is not configured with WithBucket.
+const DefaultBucket = "yacache"
+
+var (
+	// itemsBucket holds the records of items by key.
+	itemsBucket = []byte("items")
+
+	// accessBucket indexes keys by the sequence number of when they were
+	// last stored or read, so that the least recently used item is first.
+	accessBucket = []byte("access")
+
+	// expiryBucket indexes keys by when they expire, so that expired items
+	// can be compacted without reading every item.
+	expiryBucket = []byte("expiry")
+
+	// metaBucket holds the counters of the cache.
+	metaBucket = []byte("meta")
+
+	sequenceMeta = []byte("sequence")
+	versionMeta  = []byte("version")
+	countMeta    = []byte("count")
+	bytesMeta    = []byte("bytes")
+)
+
+// Cache is an implementation of yacache.Cache that stores items in a bbolt
+// database, so that they are kept when the process restarts. Each change is
+// made in a single bbolt transaction, which is durable once it commits.
+type Cache struct {
+	db       *bbolt.DB
+	bucket   []byte
+	maxSize  int
+	maxBytes int64
+	codec    simple.Codec
+	clock    yacache.Clock
+
+	compactionInterval time.Duration
+	stop               chan struct{}
+	stopped            sync.WaitGroup
+
+	evictionCallback    yacache.EvictionCallback
+	replacementCallback yacache.EvictionCallback
+
+	// lock is held with writeLock while the cache is changed, including while
+	// items are fetched, and with a weight of 1 while it is read.
+	lock *semaphore.Weighted
+
+	// touches holds the keys read since the access index was last updated,
+	// with the order they were read in. Reads are recorded in memory so that
+	// they do not need a write transaction, and are written to the index by
+	// the next transaction that changes the cache, or once touchBatchSize
+	// keys have been read.
+	touchLock sync.Mutex
+	touches   map[string]uint64
+	touchSeq  uint64
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// NewCache returns a new yacache.Cache that stores items in a bbolt database.
+// The buckets used by the cache are created if they do not exist, and items
+// already in them are kept. The database is not closed by the cache.
+func NewCache(db *bbolt.DB, options ...CacheOption) (yacache.Cache, error) {
+	cache := &Cache{
+		db:      db,
+		bucket:  []byte(DefaultBucket),
+		maxSize: -1,
+		codec:   simple.GobCodec{},
+		clock:   yacache.SystemClock,
+		stop:    make(chan struct{}),
+		lock:    semaphore.NewWeighted(writeLock),
+		touches: make(map[string]uint64),
+	}
+
+	for _, option := range options {
+		if err := option(cache); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := cache.buckets(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if cache.compactionInterval > 0 {
+		cache.stopped.Add(1)
+		go cache.compactEvery(cache.compactionInterval)
+	}
+
+	return cache, nil
+}
+
+// Close stops the background compaction started by WithCompactionInterval
+// and writes the reads that have not been written to the access index. The
+// database is not closed.
+func (c *Cache) Close() error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.stopped.Wait()
+
+	c.touchLock.Lock()
+	pending := len(c.touches)
+	c.touchLock.Unlock()
+	if pending == 0 {
+		return nil
+	}
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		return c.applyTouches(b)
+	})
+}
+
+func (c *Cache) Get(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) (yacache.Item, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	kv := key.Value()
+
+	item, err := c.lookup(kv)
+	if item != nil {
+		c.touch(kv)
+	}
+	c.lock.Release(1)
+	if err != nil {
+		return nil, err
+	}
+	if item != nil {
+		c.hits.Add(1)
+		return item, nil
+	}
+
+	c.misses.Add(1)
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return nil, err
+	}
+	defer c.lock.Release(writeLock)
+
+	// The item may have been stored while waiting for the lock.
+	if item, err := c.lookup(kv); err != nil || item != nil {
+		if item != nil {
+			c.touch(kv)
+		}
+		return item, err
+	}
+
+	cacheable, err := fetcher(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	item, _, err = c.set(kv, cacheable, nil)
+	return item, err
+}
+
+func (c *Cache) Put(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	cacheable, err := fetcher(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, _, err = c.set(key.Value(), cacheable, nil)
+	return err
+}
+
+// Set stores a cacheable for a key, replacing any item already cached for the
+// key.
+func (c *Cache) Set(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	_, _, err := c.set(key.Value(), cacheable, nil)
+	return err
+}
+
+func (c *Cache) Contains(ctx context.Context, key yacache.Key) (bool, error) {
+	_, ok, err := c.Peek(ctx, key)
+	return ok, err
+}
+
+// Peek returns the item cached for a key without fetching it and without
+// changing when it will be evicted.
+func (c *Cache) Peek(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.Release(1)
+
+	item, err := c.lookup(key.Value())
+	if err != nil || item == nil {
+		return nil, false, err
+	}
+	return item, true, nil
+}
+
+// PeekStale returns the item stored for a key, including an item that has
+// expired but has not been compacted yet, without changing when it will be
+// evicted.
+func (c *Cache) PeekStale(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.Release(1)
+
+	item, err := c.read(key.Value(), true)
+	if err != nil || item == nil {
+		return nil, false, err
+	}
+	return item, true, nil
+}
+
+func (c *Cache) Delete(ctx context.Context, key yacache.Key) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		_, _, err = b.remove(key.Value())
+		return err
+	})
+}
+
+// Stats returns the number of hits, misses, evictions and expirations seen by
+// the cache since it was created. Expirations are the expired items removed
+// by Compact.
+func (c *Cache) Stats() yacache.Stats {
+	return yacache.Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// lookup returns the live item stored for a key, or nil if there is not one,
+// in a read transaction.
+func (c *Cache) lookup(kv string) (yacache.Item, error) {
+	return c.read(kv, false)
+}
+
+// read returns the item stored for a key, or nil if there is no item or it
+// has expired and stale is false.
+func (c *Cache) read(kv string, stale bool) (yacache.Item, error) {
+	var item yacache.Item
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		current, ok, err := b.get(kv)
+		if err != nil || !ok || (!stale && c.expired(current)) {
+			return err
+		}
+		item, err = c.item(current)
+		return err
+	})
+	return item, err
+}
+
+// touch records that a key was read, writing the reads to the access index
+// once touchBatchSize keys have been read. Reads only decide the order items
+// are evicted in, so failing to write them is not an error for the read.
+func (c *Cache) touch(kv string) {
+	c.touchLock.Lock()
+	c.touchSeq++
+	c.touches[kv] = c.touchSeq
+	full := len(c.touches) >= touchBatchSize
+	c.touchLock.Unlock()
+
+	if full {
+		_ = c.db.Batch(func(tx *bbolt.Tx) error {
+			b, err := c.buckets(tx)
+			if err != nil {
+				return err
+			}
+			return c.applyTouches(b)
+		})
+	}
+}
+
+// applyTouches writes the keys read since the access index was last updated
+// to the index, in the order they were read. Keys that are no longer stored
+// are skipped.
+func (c *Cache) applyTouches(b buckets) error {
+	c.touchLock.Lock()
+	touches := c.touches
+	c.touches = make(map[string]uint64)
+	c.touchLock.Unlock()
+
+	keys := make([]string, 0, len(touches))
+	for kv := range touches {
+		keys = append(keys, kv)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return touches[keys[i]] < touches[keys[j]]
+	})
+
+	for _, kv := range keys {
+		current, ok, err := b.get(kv)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := b.touch(kv, current); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// acquire waits for the cache's lock, returning the context's error if it is
+// done before the lock is acquired.
+func (c *Cache) acquire(ctx context.Context, weight int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.lock.Acquire(ctx, weight)
+}
+
+// set stores a cacheable in a single transaction, replacing any item already
+// stored for the key, and then evicts items until the cache is within its size
+// limits. If condition is not nil, the cacheable is only stored when it
+// returns true for the live item stored for the key. It returns the item and
+// whether it was stored. An item larger than the maximum number of bytes is
+// not stored, and the callbacks are not called for it. It still removes the
+// item it replaces unless there is a condition, so that the replaced item is
+// not used again.
+func (c *Cache) set(kv string, cacheable yacache.Cacheable, condition func(current record, ok bool) bool) (yacache.Item, bool, error) {
+	var (
+		item     yacache.Item
+		replaced yacache.Item
+		evicted  []evictedItem
+		written  bool
+	)
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := c.applyTouches(b); err != nil {
+			return err
+		}
+
+		current, ok, err := b.get(kv)
+		if err != nil {
+			return err
+		}
+		ok = ok && !c.expired(current)
+		if condition != nil && !condition(current, ok) {
+			return nil
+		}
+
+		version, err := b.next(versionMeta)
+		if err != nil {
+			return err
+		}
+		stored, err := c.record(cacheable, version)
+		if err != nil {
+			return err
+		}
+		if item, err = c.item(stored); err != nil {
+			return err
+		}
+
+		if c.maxBytes > 0 && stored.size(kv) > c.maxBytes {
+			if condition != nil {
+				return nil
+			}
+			// The item being replaced is out of date, so it is removed
+			// even though its replacement can not be stored.
+			_, _, err := b.remove(kv)
+			return err
+		}
+
+		if ok && c.replacementCallback != nil {
+			if replaced, err = c.item(current); err != nil {
+				return err
+			}
+		}
+		if _, _, err := b.remove(kv); err != nil {
+			return err
+		}
+		if err := b.put(kv, stored); err != nil {
+			return err
+		}
+		written = true
+
+		evicted, err = c.evict(b)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !written {
+		return item, false, nil
+	}
+
+	if replaced != nil {
+		c.replacementCallback(simple.Key(kv), replaced)
+	}
+	c.evictions.Add(uint64(len(evicted)))
+	if c.evictionCallback != nil {
+		for _, evicted := range evicted {
+			c.evictionCallback(evicted.key, evicted.item)
+		}
+	}
+	return item, true, nil
+}
+
+// evictedItem is an item that was purged and the key it was cached for.
+type evictedItem struct {
+	key  yacache.Key
+	item yacache.Item
+}
+
+// evict removes the least recently used items until the cache is within its
+// maximum size and number of bytes.
+func (c *Cache) evict(b buckets) ([]evictedItem, error) {
+	var evicted []evictedItem
+	for (c.maxSize > 0 && b.counter(countMeta) > uint64(c.maxSize)) ||
+		(c.maxBytes > 0 && b.counter(bytesMeta) > uint64(c.maxBytes)) {
+		_, kv := b.access.Cursor().First()
+		if kv == nil {
+			break
+		}
+
+		key := string(kv)
+		removed, _, err := b.remove(key)
+		if err != nil {
+			return nil, err
+		}
+
+		// Values are only decoded for the eviction callback.
+		var item yacache.Item
+		if c.evictionCallback != nil {
+			if item, err = c.item(removed); err != nil {
+				return nil, err
+			}
+		}
+		evicted = append(evicted, evictedItem{key: simple.Key(key), item: item})
+	}
+	return evicted, nil
+}
+
+// record returns the record to store for a cacheable.
+func (c *Cache) record(cacheable yacache.Cacheable, version uint64) (record, error) {
+	r := record{
+		cached:   c.clock.Now().UnixNano(),
+		duration: cacheable.Duration(),
+		version:  version,
+	}
+	if err := cacheable.Error(); err != nil {
+		r.hasError = true
+		r.err = err.Error()
+		return r, nil
+	}
+
+	value, err := c.codec.Encode(cacheable.Value())
+	if err != nil {
+		return record{}, err
+	}
+	r.value = value
+	return r, nil
+}
+
+// item returns the item for a record. Errors are returned as new errors with
+// the same message.
+func (c *Cache) item(r record) (yacache.Item, error) {
+	cached := time.Unix(0, r.cached)
+	options := []simple.ItemOption{simple.WithItemClock(c.clock), simple.WithItemVersion(r.version)}
+	if r.hasError {
+		return simple.NewErrorItem(errors.New(r.err), cached, r.duration, options...), nil
+	}
+
+	value, err := c.codec.Decode(r.value)
+	if err != nil {
+		return nil, err
+	}
+	return simple.NewItem(value, cached, r.duration, options...), nil
+}
+
+// expired returns true if a record has expired by the cache's clock.
+func (c *Cache) expired(r record) bool {
+	return c.clock.Now().After(r.expires())
+}
+
+// buckets are the buckets of a cache in a transaction.
+type buckets struct {
+	items  *bbolt.Bucket
+	access *bbolt.Bucket
+	expiry *bbolt.Bucket
+	meta   *bbolt.Bucket
+}
+
+// buckets returns the cache's buckets in a transaction, creating them if the
+// transaction is writable.
+func (c *Cache) buckets(tx *bbolt.Tx) (buckets, error) {
+	if !tx.Writable() {
+		root := tx.Bucket(c.bucket)
+		if root == nil {
+			return buckets{}, bbolt.ErrBucketNotFound
+		}
+		return buckets{
+			items:  root.Bucket(itemsBucket),
+			access: root.Bucket(accessBucket),
+			expiry: root.Bucket(expiryBucket),
+			meta:   root.Bucket(metaBucket),
+		}, nil
+	}
+
+	root, err := tx.CreateBucketIfNotExists(c.bucket)
+	if err != nil {
+		return buckets{}, err
+	}
+	var b buckets
+	for _, bucket := range []struct {
+		name   []byte
+		bucket **bbolt.Bucket
+	}{
+		{itemsBucket, &b.items},
+		{accessBucket, &b.access},
+		{expiryBucket, &b.expiry},
+		{metaBucket, &b.meta},
+	} {
+		if *bucket.bucket, err = root.CreateBucketIfNotExists(bucket.name); err != nil {
+			return buckets{}, err
+		}
+	}
+	return b, nil
+}
+
+// get returns the record stored for a key.
+func (b buckets) get(kv string) (record, bool, error) {
+	data := b.items.Get([]byte(kv))
+	if data == nil {
+		return record{}, false, nil
+	}
+	r, err := unmarshalRecord(data)
+	if err != nil {
+		return record{}, false, err
+	}
+	return r, true, nil
+}
+
+// put stores a record for a key that is not stored, making it the most
+// recently used item.
+func (b buckets) put(kv string, r record) error {
+	access, err := b.next(sequenceMeta)
+	if err != nil {
+		return err
+	}
+	r.access = access
+	if err := b.items.Put([]byte(kv), r.marshal()); err != nil {
+		return err
+	}
+	if err := b.access.Put(sequenceKey(r.access), []byte(kv)); err != nil {
+		return err
+	}
+	if err := b.expiry.Put(expiryKey(kv, r), nil); err != nil {
+		return err
+	}
+	if err := b.add(countMeta, 1); err != nil {
+		return err
+	}
+	return b.add(bytesMeta, r.size(kv))
+}
+
+// remove deletes the record stored for a key and its index entries, returning
+// the record that was removed.
+func (b buckets) remove(kv string) (record, bool, error) {
+	r, ok, err := b.get(kv)
+	if err != nil || !ok {
+		return record{}, false, err
+	}
+	if err := b.items.Delete([]byte(kv)); err != nil {
+		return record{}, false, err
+	}
+	if err := b.access.Delete(sequenceKey(r.access)); err != nil {
+		return record{}, false, err
+	}
+	if err := b.expiry.Delete(expiryKey(kv, r)); err != nil {
+		return record{}, false, err
+	}
+	if err := b.add(countMeta, -1); err != nil {
+		return record{}, false, err
+	}
+	if err := b.add(bytesMeta, -r.size(kv)); err != nil {
+		return record{}, false, err
+	}
+	return r, true, nil
+}
+
+// touch makes the record stored for a key the most recently used item.
+func (b buckets) touch(kv string, r record) error {
+	if err := b.access.Delete(sequenceKey(r.access)); err != nil {
+		return err
+	}
+	access, err := b.next(sequenceMeta)
+	if err != nil {
+		return err
+	}
+	r.access = access
+	if err := b.items.Put([]byte(kv), r.marshal()); err != nil {
+		return err
+	}
+	return b.access.Put(sequenceKey(r.access), []byte(kv))
+}
+
+// counter returns the value of a counter in the meta bucket.
+func (b buckets) counter(name []byte) uint64 {
+	data := b.meta.Get(name)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// add adds delta to a counter in the meta bucket.
+func (b buckets) add(name []byte, delta int64) error {
+	return b.meta.Put(name, sequenceKey(b.counter(name)+uint64(delta)))
+}
+
+// next increments a counter in the meta bucket and returns its new value.
+func (b buckets) next(name []byte) (uint64, error) {
+	value := b.counter(name) + 1
+	if err := b.meta.Put(name, sequenceKey(value)); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -0,0 +1,88 @@
+package disk
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/simple"
+)
+
+type CacheOption func(cache *Cache) error
+
+// WithBucket configures the name of the bucket that the cache stores items
+// in, so that several caches can share a database. The default bucket is
+// DefaultBucket.
+func WithBucket(name string) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		if name == "" {
+			return errors.New("yacache: bucket name must not be empty")
+		}
+		cache.bucket = []byte(name)
+		return nil
+	}
+}
+
+// WithMaxSize configures the maximum number of elements that the cache
+// will contain.
+func WithMaxSize(size int) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.maxSize = size
+		return nil
+	}
+}
+
+// WithMaxBytes configures the maximum number of bytes used by the keys and
+// encoded values of the elements that the cache will contain. The space used
+// by the database itself is not counted.
+func WithMaxBytes(size int64) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.maxBytes = size
+		return nil
+	}
+}
+
+// WithEvictionHandler configures the eviction callback function for the
+// cache.
+func WithEvictionHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.evictionCallback = callback
+		return nil
+	}
+}
+
+// WithReplacementHandler configures a callback that is called with the item
+// that was replaced when an item is stored for a key that is already cached.
+func WithReplacementHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.replacementCallback = callback
+		return nil
+	}
+}
+
+// WithCodec configures the codec used to encode the values of items. The
+// default codec is simple.GobCodec.
+func WithCodec(codec simple.Codec) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.codec = codec
+		return nil
+	}
+}
+
+// WithCompactionInterval configures the cache to remove expired items at an
+// interval until it is closed.
+func WithCompactionInterval(interval time.Duration) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.compactionInterval = interval
+		return nil
+	}
+}
+
+// WithClock configures the clock used to record when items are cached and to
+// decide if they have expired.
+func WithClock(clock yacache.Clock) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.clock = clock
+		return nil
+	}
+}
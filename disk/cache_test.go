@@ -0,0 +1,346 @@
+package disk
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/cachetest"
+	"github.com/ngerakines/yacache/simple"
+	"go.etcd.io/bbolt"
+)
+
+// openDB opens a database in a temporary directory that is closed when the
+// test finishes.
+func openDB(t *testing.T, path string) *bbolt.DB {
+	t.Helper()
+
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "cache.db")
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func newCache(t *testing.T, db *bbolt.DB, options ...CacheOption) *Cache {
+	t.Helper()
+
+	c, err := NewCache(db, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.(*Cache).Close()
+	})
+	return c.(*Cache)
+}
+
+func valueFetcher(value string, duration time.Duration) yacache.Fetcher {
+	return func(ctx context.Context, key yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue(value, duration), nil
+	}
+}
+
+func TestCacheSuite(t *testing.T) {
+	cachetest.RunSuite(t, func(t *testing.T, config cachetest.Config) yacache.Cache {
+		return newCache(t, openDB(t, ""),
+			WithMaxSize(config.MaxSize),
+			WithEvictionHandler(config.EvictionCallback),
+			WithReplacementHandler(config.ReplacementCallback),
+			WithClock(config.Clock),
+		)
+	})
+}
+
+func TestCacheMaxSize(t *testing.T) {
+	c := newCache(t, openDB(t, ""), WithMaxSize(5))
+
+	cachetest.MaxSize(t, c, valueFetcher("value", time.Hour), func(s string) yacache.Key {
+		return simple.Key(s)
+	})
+}
+
+// countingCodec is a simple.GobCodec that counts the values it decodes.
+type countingCodec struct {
+	simple.GobCodec
+	decoded *int
+}
+
+func (c countingCodec) Decode(data []byte) (interface{}, error) {
+	*c.decoded++
+	return c.GobCodec.Decode(data)
+}
+
+func TestCacheEvictWithoutCallback(t *testing.T) {
+	ctx := context.Background()
+	decoded := 0
+	c := newCache(t, openDB(t, ""), WithMaxSize(1), WithCodec(countingCodec{decoded: &decoded}))
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, simple.Key(key), simple.NewCacheableValue("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decoded != 3 {
+		t.Fatalf("expected only the stored values to be decoded but %d values were", decoded)
+	}
+}
+
+func TestCacheReads(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "")
+
+	var evicted []string
+	c := newCache(t, db,
+		WithMaxSize(2),
+		WithEvictionHandler(func(key yacache.Key, item yacache.Item) {
+			evicted = append(evicted, key.Value())
+		}),
+	)
+
+	txID := func() int {
+		var id int
+		db.View(func(tx *bbolt.Tx) error {
+			id = tx.ID()
+			return nil
+		})
+		return id
+	}
+
+	for _, k := range []string{"a", "b"} {
+		if err := c.Put(ctx, simple.Key(k), valueFetcher("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := txID()
+	for i := 0; i < 10; i++ {
+		if _, err := c.Get(ctx, simple.Key("a"), valueFetcher("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := txID(); after != before {
+		t.Fatalf("expected reads not to write to the database but it went from %d to %d", before, after)
+	}
+
+	// The reads are written to the access index when the cache is changed.
+	if err := c.Put(ctx, simple.Key("c"), valueFetcher("value", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Fatalf("expected the least recently used item to be evicted but got %v", evicted)
+	}
+}
+
+func TestCachePeekStale(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+	c := newCache(t, openDB(t, ""), WithClock(clock))
+
+	if err := c.Set(ctx, simple.Key("a"), simple.NewCacheableValue("value", time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+
+	if _, ok, err := c.Peek(ctx, simple.Key("a")); err != nil || ok {
+		t.Fatalf("expected Peek not to return the expired item: %v", err)
+	}
+	if item, ok, err := c.PeekStale(ctx, simple.Key("a")); err != nil || !ok || !item.Expired() {
+		t.Fatalf("expected PeekStale to return the expired item but got %v: %v", item, err)
+	}
+}
+
+func TestCachePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCache(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put(ctx, simple.Key("foo"), valueFetcher("bar", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newCache(t, openDB(t, path))
+	item, ok, err := reopened.Peek(ctx, simple.Key("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || item.Value() != "bar" {
+		t.Fatalf("expected the item to be kept but got %v", item)
+	}
+	if count, err := reopened.Len(ctx); err != nil || count != 1 {
+		t.Fatalf("expected 1 item but got %d: %v", count, err)
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	value := strings.Repeat("x", 100)
+
+	var evicted []string
+	c := newCache(t, openDB(t, ""),
+		WithMaxBytes(500),
+		WithEvictionHandler(func(key yacache.Key, item yacache.Item) {
+			evicted = append(evicted, key.Value())
+		}),
+	)
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		if _, err := c.Get(ctx, simple.Key(key), valueFetcher(value, time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(evicted) == 0 || evicted[0] != "a" {
+		t.Fatalf("expected the least recently used items to be evicted but got %v", evicted)
+	}
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		if size := b.counter(bytesMeta); size > 500 {
+			t.Errorf("expected at most 500 bytes but got %d", size)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Set(ctx, simple.Key("big"), simple.NewCacheableValue(strings.Repeat("x", 1000), time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Contains(ctx, simple.Key("big")); err != nil || ok {
+		t.Fatalf("expected an item larger than the maximum bytes not to be stored: %v", err)
+	}
+	if ok, err := c.Contains(ctx, simple.Key("f")); err != nil || !ok {
+		t.Fatalf("expected other items to be kept: %v", err)
+	}
+}
+
+func TestCacheMaxBytesConditional(t *testing.T) {
+	ctx := context.Background()
+	large := simple.NewCacheableValue(strings.Repeat("x", 1000), time.Hour)
+
+	replaced := 0
+	c := newCache(t, openDB(t, ""),
+		WithMaxBytes(500),
+		WithReplacementHandler(func(key yacache.Key, item yacache.Item) {
+			replaced++
+		}),
+	)
+
+	if stored, err := c.SetIfAbsent(ctx, simple.Key("a"), large); err != nil || stored {
+		t.Fatalf("expected SetIfAbsent not to store an item larger than the maximum bytes: %v, %v", stored, err)
+	}
+	if ok, err := c.Contains(ctx, simple.Key("a")); err != nil || ok {
+		t.Fatalf("expected the item not to be stored: %v", err)
+	}
+
+	if err := c.Set(ctx, simple.Key("b"), simple.NewCacheableValue("small", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	item, _, err := c.Peek(ctx, simple.Key("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := item.(yacache.Versioned).Version()
+	if stored, err := c.SetIfVersion(ctx, simple.Key("b"), large, version); err != nil || stored {
+		t.Fatalf("expected SetIfVersion not to store an item larger than the maximum bytes: %v, %v", stored, err)
+	}
+	if item, ok, err := c.Peek(ctx, simple.Key("b")); err != nil || !ok || item.Value() != "small" {
+		t.Fatalf("expected the current item to be kept but got %v: %v", item, err)
+	}
+	if replaced != 0 {
+		t.Fatalf("expected the replacement callback not to be called but it was called %d times", replaced)
+	}
+}
+
+func TestCacheCompact(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+	c := newCache(t, openDB(t, ""), WithClock(clock))
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Put(ctx, simple.Key(key), valueFetcher("short", time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Put(ctx, simple.Key("d"), valueFetcher("long", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Minute)
+
+	if count, err := c.Len(ctx); err != nil || count != 1 {
+		t.Fatalf("expected 1 live item but got %d: %v", count, err)
+	}
+
+	removed, err := c.Compact(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Fatalf("expected 3 expired items to be removed but got %d", removed)
+	}
+	if stats := c.Stats(); stats.Expirations != 3 {
+		t.Fatalf("expected 3 expirations but got %d", stats.Expirations)
+	}
+
+	err = c.db.View(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		if count := b.items.Stats().KeyN; count != 1 {
+			t.Errorf("expected 1 stored item but got %d", count)
+		}
+		if count := b.counter(countMeta); count != 1 {
+			t.Errorf("expected a count of 1 but got %d", count)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheBuckets(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "")
+	first := newCache(t, db, WithBucket("first"))
+	second := newCache(t, db, WithBucket("second"))
+
+	if err := first.Put(ctx, simple.Key("foo"), valueFetcher("first", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := second.Contains(ctx, simple.Key("foo")); err != nil || ok {
+		t.Fatalf("expected caches with different buckets not to share items: %v", err)
+	}
+
+	if err := second.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := first.Contains(ctx, simple.Key("foo")); err != nil || !ok {
+		t.Fatalf("expected clearing a cache not to remove items from other buckets: %v", err)
+	}
+}
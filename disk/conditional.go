@@ -0,0 +1,61 @@
+package disk
+
+import (
+	"context"
+
+	"github.com/ngerakines/yacache"
+	"go.etcd.io/bbolt"
+)
+
+// SetIfAbsent stores a cacheable if no item that has not expired is cached
+// for the key. It returns true if the cacheable was stored.
+func (c *Cache) SetIfAbsent(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) (bool, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(writeLock)
+
+	_, stored, err := c.set(key.Value(), cacheable, func(current record, ok bool) bool {
+		return !ok
+	})
+	return stored, err
+}
+
+// SetIfVersion stores a cacheable if the item cached for the key has not
+// expired and has the version. It returns true if the cacheable was stored.
+func (c *Cache) SetIfVersion(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable, version uint64) (bool, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(writeLock)
+
+	_, stored, err := c.set(key.Value(), cacheable, func(current record, ok bool) bool {
+		return ok && current.version == version
+	})
+	return stored, err
+}
+
+// DeleteIfVersion removes the item cached for the key if it has not expired
+// and has the version. It returns true if the item was removed.
+func (c *Cache) DeleteIfVersion(ctx context.Context, key yacache.Key, version uint64) (bool, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(writeLock)
+
+	kv := key.Value()
+	removed := false
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		current, ok, err := b.get(kv)
+		if err != nil || !ok || c.expired(current) || current.version != version {
+			return err
+		}
+		_, removed, err = b.remove(kv)
+		return err
+	})
+	return removed, err
+}
@@ -0,0 +1,168 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// keysCount is the number of keys returned by Keys when a count is not given.
+const keysCount = 100
+
+// Len returns the number of items in the cache that have not expired.
+func (c *Cache) Len(ctx context.Context) (int, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(1)
+
+	count := 0
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		count = int(b.counter(countMeta)) - len(c.expiredKeys(b))
+		return nil
+	})
+	return count, err
+}
+
+// Keys returns a page of the keys of items in the cache that start with
+// prefix and have not expired, in sorted order. An empty cursor starts at the
+// first page, and the returned cursor is empty after the last page. Listing
+// keys does not change the order items are evicted in.
+func (c *Cache) Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error) {
+	start := prefix
+	if cursor != "" {
+		if !strings.HasPrefix(cursor, ">") {
+			return nil, "", fmt.Errorf("yacache: invalid cursor %q", cursor)
+		}
+		start = cursor[1:]
+	}
+	if count <= 0 {
+		count = keysCount
+	}
+
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, "", err
+	}
+	defer c.lock.Release(1)
+
+	var keys []string
+	next := ""
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		items := b.items.Cursor()
+		for k, data := items.Seek([]byte(start)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, data = items.Next() {
+			if cursor != "" && string(k) == start {
+				continue
+			}
+			r, err := unmarshalRecord(data)
+			if err != nil {
+				return err
+			}
+			if c.expired(r) {
+				continue
+			}
+			if len(keys) == count {
+				next = ">" + keys[count-1]
+				return nil
+			}
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, next, nil
+}
+
+// Clear removes every item from the cache. The eviction callback is not
+// called for removed items.
+func (c *Cache) Clear(ctx context.Context) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(c.bucket); err != nil && err != bbolt.ErrBucketNotFound {
+			return err
+		}
+		_, err := c.buckets(tx)
+		return err
+	})
+}
+
+// Compact removes the items that have expired, returning the number of items
+// removed. Expired items are otherwise only removed when they are replaced or
+// evicted, and count towards the size of the cache until then.
+func (c *Cache) Compact(ctx context.Context) (int, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(writeLock)
+
+	removed := 0
+	err := c.db.Update(func(tx *bbolt.Tx) error {
+		b, err := c.buckets(tx)
+		if err != nil {
+			return err
+		}
+		for _, kv := range c.expiredKeys(b) {
+			if _, ok, err := b.remove(kv); err != nil {
+				return err
+			} else if ok {
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.expirations.Add(uint64(removed))
+	return removed, nil
+}
+
+// expiredKeys returns the keys of the items that have expired, using the
+// expiry index so that only expired items are read.
+func (c *Cache) expiredKeys(b buckets) []string {
+	now := uint64(c.clock.Now().UnixNano())
+
+	var keys []string
+	expiry := b.expiry.Cursor()
+	for k, _ := expiry.First(); k != nil && binary.BigEndian.Uint64(k) < now; k, _ = expiry.Next() {
+		keys = append(keys, string(k[8:]))
+	}
+	return keys
+}
+
+// compactEvery calls Compact at an interval until the cache is closed.
+func (c *Cache) compactEvery(interval time.Duration) {
+	defer c.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			_, _ = c.Compact(context.Background())
+		}
+	}
+}
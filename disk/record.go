@@ -0,0 +1,97 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// recordFormat is the version of the layout of records, which is the first
+// byte of each record.
+const recordFormat = 1
+
+// recordHeaderSize is the size of the fixed length fields of a record: the
+// format, flags, cached time, duration, version, access sequence and the
+// length of the error.
+const recordHeaderSize = 1 + 1 + 8 + 8 + 8 + 8 + 4
+
+const hasErrorFlag = 1
+
+var errInvalidRecord = errors.New("yacache: invalid record")
+
+// record is an item as it is stored in the database.
+type record struct {
+	value    []byte
+	err      string
+	hasError bool
+	cached   int64
+	duration time.Duration
+	version  uint64
+
+	// access is the sequence number of the last time the item was stored
+	// or read, which orders items from least to most recently used.
+	access uint64
+}
+
+func (r record) marshal() []byte {
+	data := make([]byte, recordHeaderSize, recordHeaderSize+len(r.err)+len(r.value))
+	data[0] = recordFormat
+	if r.hasError {
+		data[1] = hasErrorFlag
+	}
+	binary.BigEndian.PutUint64(data[2:], uint64(r.cached))
+	binary.BigEndian.PutUint64(data[10:], uint64(r.duration))
+	binary.BigEndian.PutUint64(data[18:], r.version)
+	binary.BigEndian.PutUint64(data[26:], r.access)
+	binary.BigEndian.PutUint32(data[34:], uint32(len(r.err)))
+	data = append(data, r.err...)
+	return append(data, r.value...)
+}
+
+func unmarshalRecord(data []byte) (record, error) {
+	if len(data) < recordHeaderSize || data[0] != recordFormat {
+		return record{}, errInvalidRecord
+	}
+	errLen := int(binary.BigEndian.Uint32(data[34:]))
+	if len(data) < recordHeaderSize+errLen {
+		return record{}, errInvalidRecord
+	}
+
+	r := record{
+		hasError: data[1]&hasErrorFlag != 0,
+		cached:   int64(binary.BigEndian.Uint64(data[2:])),
+		duration: time.Duration(binary.BigEndian.Uint64(data[10:])),
+		version:  binary.BigEndian.Uint64(data[18:]),
+		access:   binary.BigEndian.Uint64(data[26:]),
+		err:      string(data[recordHeaderSize : recordHeaderSize+errLen]),
+	}
+	// The value is copied because bbolt's memory is only valid during the
+	// transaction.
+	r.value = append([]byte(nil), data[recordHeaderSize+errLen:]...)
+	return r, nil
+}
+
+// expires returns the time that the record expires.
+func (r record) expires() time.Time {
+	return time.Unix(0, r.cached).Add(r.duration)
+}
+
+// size returns the number of bytes used to store a record for a key.
+func (r record) size(kv string) int64 {
+	return int64(len(kv) + recordHeaderSize + len(r.err) + len(r.value))
+}
+
+// sequenceKey returns the key of the access index for a sequence number.
+func sequenceKey(sequence uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
+
+// expiryKey returns the key of the expiry index for a record, which sorts
+// records by when they expire.
+func expiryKey(kv string, r record) []byte {
+	key := make([]byte, 8, 8+len(kv))
+	binary.BigEndian.PutUint64(key, uint64(r.expires().UnixNano()))
+	return append(key, kv...)
+}
@@ -38,3 +38,12 @@ func EnsureCacheDelete(cache Cache, ctx context.Context, key Key) {
 		panic(err)
 	}
 }
+
+// EnsureCacheSet stores a cacheable into the cache, but panics if an error is
+// returned.
+func EnsureCacheSet(cache Cache, ctx context.Context, key Key, cacheable Cacheable) {
+	err := Set(ctx, cache, key, cacheable)
+	if err != nil {
+		panic(err)
+	}
+}
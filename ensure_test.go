@@ -60,3 +60,12 @@ func TestEnsureCacheDelete(t *testing.T) {
 	}()
 	EnsureCacheDelete(failingCache{}, context.Background(), nil)
 }
+
+func TestEnsureCacheSet(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("The code did not panic")
+		}
+	}()
+	EnsureCacheSet(failingCache{}, context.Background(), nil, nil)
+}
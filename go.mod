@@ -1,8 +1,18 @@
 module github.com/ngerakines/yacache
 
+go 1.21
+
 require (
-	github.com/go-redis/redis v6.15.1+incompatible
-	github.com/onsi/ginkgo v1.7.0 // indirect
-	github.com/onsi/gomega v1.4.3 // indirect
+	github.com/alicebob/miniredis/v2 v2.37.0
 	github.com/pkg/errors v0.8.1
+	github.com/redis/go-redis/v9 v9.17.2
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/sync v0.10.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sys v0.4.0 // indirect
 )
@@ -0,0 +1,100 @@
+package httpcache
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
+
+// DefaultMaxBodySize is the size of the largest body that is cached, in bytes,
+// unless WithMaxBodySize is used.
+const DefaultMaxBodySize = 10 << 20
+
+// Option configures a Handler or a Transport.
+type Option func(config *config)
+
+// config holds the options shared by Handler and Transport.
+type config struct {
+	key             KeyFunc
+	defaultDuration time.Duration
+	staleRetention  time.Duration
+	maxBodySize     int64
+	clock           yacache.Clock
+	errorHandler    func(r *http.Request, err error)
+}
+
+func newConfig(options []Option) config {
+	c := config{
+		key:            DefaultKey,
+		staleRetention: DefaultStaleRetention,
+		maxBodySize:    DefaultMaxBodySize,
+		clock:          yacache.SystemClock,
+	}
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// handleError gives an error returned by the cache to the error handler.
+func (c config) handleError(r *http.Request, err error) {
+	if err != nil && c.errorHandler != nil {
+		c.errorHandler(r, err)
+	}
+}
+
+// WithKeyFunc configures the function that returns the key that responses
+// are cached under. The default is DefaultKey.
+func WithKeyFunc(key KeyFunc) Option {
+	return func(config *config) {
+		config.key = key
+	}
+}
+
+// WithDefaultDuration configures how long responses that do not have a
+// max-age, s-maxage or Expires header are cached for. By default, they are
+// not cached by a Handler, and a Transport caches them for a tenth of the
+// time since they were last modified if they have a Last-Modified header.
+func WithDefaultDuration(duration time.Duration) Option {
+	return func(config *config) {
+		config.defaultDuration = duration
+	}
+}
+
+// WithStaleRetention configures how long a Transport keeps responses that
+// have an ETag or Last-Modified header after they become stale, so that they
+// can be revalidated instead of fetched again. The default is
+// DefaultStaleRetention.
+func WithStaleRetention(retention time.Duration) Option {
+	return func(config *config) {
+		config.staleRetention = retention
+	}
+}
+
+// WithMaxBodySize configures the size of the largest body that is cached, in
+// bytes. Larger responses are passed on without being cached. The default is
+// DefaultMaxBodySize, and a size of 0 caches bodies of any size.
+func WithMaxBodySize(size int64) Option {
+	return func(config *config) {
+		config.maxBodySize = size
+	}
+}
+
+// WithErrorHandler configures a function that is called with the errors
+// returned by the cache. Cache errors do not fail requests; responses that
+// can not be read from the cache are fetched again.
+func WithErrorHandler(errorHandler func(r *http.Request, err error)) Option {
+	return func(config *config) {
+		config.errorHandler = errorHandler
+	}
+}
+
+// WithClock configures the clock used to calculate the age of cached
+// responses and when responses with an Expires header expire. It should be
+// the same clock as the cache's.
+func WithClock(clock yacache.Clock) Option {
+	return func(config *config) {
+		config.clock = clock
+	}
+}
@@ -0,0 +1,305 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
+
+// KeyFunc returns the key that the response to a request is cached under,
+// before the headers listed by the response's Vary header are added.
+type KeyFunc func(r *http.Request) string
+
+// DefaultKey returns the method, scheme, host and request URI of a request,
+// such as "GET https://example.com/items?page=2". The scheme of requests
+// received by a server is https if they were received over TLS.
+func DefaultKey(r *http.Request) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	return r.Method + " " + scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// cacheableStatus holds the status codes of responses that can be cached.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// Handler is net/http middleware that caches the responses of another
+// handler in a yacache.Cache.
+//
+// Only responses to GET and HEAD requests are cached. Responses are cached
+// for their s-maxage or max-age Cache-Control directive, or until their
+// Expires header, and are not cached if they have the no-store, no-cache or
+// private directives or set cookies. Requests with the no-store directive are
+// not served from the cache and their responses are not cached, requests with
+// the no-cache directive are not served from the cache, and requests with the
+// max-age directive are only served cached responses that are no older.
+//
+// Unsafe requests, such as POST and DELETE requests, remove the responses
+// cached for their URL and their response's Location and Content-Location
+// headers when they succeed.
+//
+// Responses that vary on request headers are cached once for each
+// combination of the values of those headers. Cached 200 responses to GET
+// requests are given an ETag if they do not have one, and conditional
+// requests that match their ETag or Last-Modified headers are answered with
+// 304 Not Modified.
+//
+// Responses are buffered so that they can be stored, unless they can not be
+// cached or are larger than DefaultMaxBodySize, or the size configured with
+// WithMaxBodySize.
+type Handler struct {
+	cache yacache.Cache
+	next  http.Handler
+	config
+}
+
+// NewHandler returns a Handler that caches the responses of next.
+func NewHandler(cache yacache.Cache, next http.Handler, options ...Option) *Handler {
+	return &Handler{
+		cache:  cache,
+		next:   next,
+		config: newConfig(options),
+	}
+}
+
+// Middleware returns a function that wraps handlers with a Handler.
+func Middleware(cache yacache.Cache, options ...Option) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return NewHandler(cache, next, options...)
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !safeMethods[r.Method] {
+		invalidator := &invalidator{ResponseWriter: w, handler: h, request: r}
+		h.next.ServeHTTP(invalidator, r)
+		if !invalidator.wroteHeader {
+			invalidator.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Range") != "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	requestControl := parseCacheControl(r.Header)
+	if requestControl.has("no-store") {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	key := h.key(r)
+
+	if !requestControl.has("no-cache") {
+		maxAge, limited := requestControl.seconds("max-age")
+		if cached, age, ok := h.lookup(ctx, r, key); ok && (!limited || age <= maxAge) {
+			h.serve(w, r, cached, age)
+			return
+		}
+	}
+
+	recorder := &recorder{ResponseWriter: w, handler: h, request: r}
+	h.next.ServeHTTP(recorder, r)
+	if !recorder.wroteHeader {
+		recorder.WriteHeader(http.StatusOK)
+	}
+	if recorder.passthrough {
+		return
+	}
+
+	header := w.Header()
+	// The body of a response to a HEAD request is empty, so it does not
+	// identify the entity.
+	if recorder.status == http.StatusOK && r.Method != http.MethodHead && header.Get("ETag") == "" {
+		header.Set("ETag", etag(recorder.body.Bytes()))
+	}
+	fresh := response{status: recorder.status, header: header.Clone(), body: recorder.body.Bytes()}
+
+	h.handleError(r, save(ctx, h.cache, key, r.Header, fresh, recorder.lifetime))
+	h.serve(w, r, fresh, -1)
+}
+
+// lookup returns the cached response for a request and its age. Errors are
+// given to the error handler and treated as misses.
+func (h *Handler) lookup(ctx context.Context, r *http.Request, key string) (response, time.Duration, bool) {
+	cached, item, ok, err := load(ctx, h.cache, key, r.Header)
+	if err != nil || !ok {
+		h.handleError(r, err)
+		return response{}, 0, false
+	}
+	return cached, h.clock.Now().Sub(item.Cached()), true
+}
+
+// serve writes a response, or 304 Not Modified if it matches the request's
+// conditional headers. Responses served from the cache have an age of at
+// least 0, which is sent in the Age header.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, cached response, age time.Duration) {
+	header := w.Header()
+	for name, values := range cached.header {
+		header[name] = append([]string(nil), values...)
+	}
+	if age >= 0 {
+		header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	}
+
+	if cached.status == http.StatusOK && notModified(r, header) {
+		writeNotModified(w)
+		return
+	}
+
+	w.WriteHeader(cached.status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(cached.body)
+	}
+}
+
+// lifetime returns how long a response can be cached for, or false if it can
+// not be cached.
+func (h *Handler) lifetime(r *http.Request, status int, header http.Header) (time.Duration, bool) {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, name := range varyNames(header) {
+		if name == "*" {
+			return 0, false
+		}
+	}
+
+	cc := parseCacheControl(header)
+	if cc.has("no-store") || cc.has("no-cache") || cc.has("private") {
+		return 0, false
+	}
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return 0, false
+	}
+
+	if lifetime, ok := cc.seconds("s-maxage"); ok {
+		return lifetime, lifetime > 0
+	}
+	if lifetime, ok := cc.seconds("max-age"); ok {
+		return lifetime, lifetime > 0
+	}
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0, false
+		}
+		lifetime := expires.Sub(h.clock.Now())
+		return lifetime, lifetime > 0
+	}
+	return h.defaultDuration, h.defaultDuration > 0
+}
+
+// recorder buffers the response of the next handler if it can be cached, and
+// writes it through otherwise.
+type recorder struct {
+	http.ResponseWriter
+	handler *Handler
+	request *http.Request
+
+	status      int
+	lifetime    time.Duration
+	body        bytes.Buffer
+	wroteHeader bool
+	passthrough bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+
+	lifetime, ok := r.handler.lifetime(r.request, status, r.Header())
+	if !ok {
+		r.passthrough = true
+		r.ResponseWriter.WriteHeader(status)
+		return
+	}
+	r.lifetime = lifetime
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.passthrough {
+		return r.ResponseWriter.Write(p)
+	}
+
+	if maxBodySize := r.handler.maxBodySize; maxBodySize > 0 && int64(r.body.Len()+len(p)) > maxBodySize {
+		r.passthrough = true
+		r.ResponseWriter.WriteHeader(r.status)
+		if _, err := r.ResponseWriter.Write(r.body.Bytes()); err != nil {
+			return 0, err
+		}
+		r.body.Reset()
+		return r.ResponseWriter.Write(p)
+	}
+	return r.body.Write(p)
+}
+
+// Flush flushes responses that are written through. Buffered responses are
+// written when the next handler returns.
+func (r *recorder) Flush() {
+	if !r.passthrough {
+		return
+	}
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// invalidator removes the responses cached for the targets of an unsafe
+// request when the next handler writes its response's status.
+type invalidator struct {
+	http.ResponseWriter
+	handler *Handler
+	request *http.Request
+
+	wroteHeader bool
+}
+
+func (i *invalidator) WriteHeader(status int) {
+	if !i.wroteHeader {
+		i.wroteHeader = true
+		h, r := i.handler, i.request
+		h.handleError(r, invalidate(r.Context(), h.cache, h.key, r, status, i.Header()))
+	}
+	i.ResponseWriter.WriteHeader(status)
+}
+
+func (i *invalidator) Write(p []byte) (int, error) {
+	if !i.wroteHeader {
+		i.WriteHeader(http.StatusOK)
+	}
+	return i.ResponseWriter.Write(p)
+}
+
+func (i *invalidator) Flush() {
+	if flusher, ok := i.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
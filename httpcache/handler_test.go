@@ -0,0 +1,337 @@
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/cachetest"
+	"github.com/ngerakines/yacache/simple"
+)
+
+// countingHandler returns a handler that responds with the number of times it
+// has been called, with the Cache-Control header given.
+func countingHandler(cacheControl string) (http.Handler, *int) {
+	calls := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d", calls)
+	}), &calls
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerCaches(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	next, calls := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(simple.WithClock(clock)), next, WithClock(clock))
+
+	first := serve(handler, httptest.NewRequest(http.MethodGet, "/items?page=1", nil))
+	if first.Body.String() != "call 1" || first.Header().Get("ETag") == "" {
+		t.Fatalf("unexpected first response: %q %v", first.Body.String(), first.Header())
+	}
+
+	clock.Advance(10 * time.Second)
+	second := serve(handler, httptest.NewRequest(http.MethodGet, "/items?page=1", nil))
+	if second.Body.String() != "call 1" || *calls != 1 {
+		t.Fatalf("expected the cached response but got %q after %d calls", second.Body.String(), *calls)
+	}
+	if second.Header().Get("Age") != "10" || second.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected cached headers: %v", second.Header())
+	}
+	if second.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Fatal("expected the cached response to have the same ETag")
+	}
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/items?page=2", nil))
+	serve(handler, httptest.NewRequest(http.MethodPost, "/items?page=1", nil))
+	if *calls != 3 {
+		t.Fatalf("expected other URLs and methods not to be served from the cache, got %d calls", *calls)
+	}
+
+	clock.Advance(time.Minute)
+	if expired := serve(handler, httptest.NewRequest(http.MethodGet, "/items?page=1", nil)); expired.Body.String() != "call 4" {
+		t.Fatalf("expected the response to expire but got %q", expired.Body.String())
+	}
+}
+
+func TestHandlerCacheControl(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		cached       bool
+		duration     time.Duration
+	}{
+		{"max-age=60", true, time.Minute},
+		{"public, max-age=60, s-maxage=300", true, 5 * time.Minute},
+		{"max-age=0", false, 0},
+		{"no-store, max-age=60", false, 0},
+		{"no-cache, max-age=60", false, 0},
+		{"private, max-age=60", false, 0},
+		{"", false, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.cacheControl, func(t *testing.T) {
+			cache := simple.NewCache()
+			next, calls := countingHandler(test.cacheControl)
+			handler := NewHandler(cache, next)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			serve(handler, r)
+			serve(handler, r)
+			if cached := *calls == 1; cached != test.cached {
+				t.Fatalf("expected cached to be %t but the handler was called %d times", test.cached, *calls)
+			}
+
+			if test.cached {
+				item, ok, err := cache.(yacache.Peeker).Peek(r.Context(), simple.Key(DefaultKey(r)))
+				if err != nil || !ok {
+					t.Fatalf("expected the response to be cached: %v", err)
+				}
+				if item.Duration() != test.duration {
+					t.Fatalf("expected a duration of %s but got %s", test.duration, item.Duration())
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerRequestCacheControl(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(), next)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	noStore := httptest.NewRequest(http.MethodGet, "/", nil)
+	noStore.Header.Set("Cache-Control", "no-store")
+	if w := serve(handler, noStore); w.Body.String() != "call 2" {
+		t.Fatalf("expected no-store requests to bypass the cache but got %q", w.Body.String())
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil)); w.Body.String() != "call 1" {
+		t.Fatalf("expected no-store responses not to be cached but got %q", w.Body.String())
+	}
+
+	noCache := httptest.NewRequest(http.MethodGet, "/", nil)
+	noCache.Header.Set("Cache-Control", "no-cache")
+	serve(handler, noCache)
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil)); w.Body.String() != "call 3" || *calls != 3 {
+		t.Fatalf("expected no-cache requests to refresh the cache but got %q", w.Body.String())
+	}
+}
+
+func TestHandlerRequestMaxAge(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	next, calls := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(simple.WithClock(clock)), next, WithClock(clock))
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	clock.Advance(10 * time.Second)
+
+	younger := httptest.NewRequest(http.MethodGet, "/", nil)
+	younger.Header.Set("Cache-Control", "max-age=30")
+	if w := serve(handler, younger); w.Body.String() != "call 1" {
+		t.Fatalf("expected a response younger than max-age to be served from the cache but got %q", w.Body.String())
+	}
+
+	older := httptest.NewRequest(http.MethodGet, "/", nil)
+	older.Header.Set("Cache-Control", "max-age=5")
+	if w := serve(handler, older); w.Body.String() != "call 2" || *calls != 2 {
+		t.Fatalf("expected a response older than max-age to be refreshed but got %q", w.Body.String())
+	}
+}
+
+func TestHandlerVary(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "hello %s", r.Header.Get("Accept-Language"))
+	})
+	handler := NewHandler(simple.NewCache(), next)
+
+	for i := 0; i < 2; i++ {
+		for _, language := range []string{"en", "fr"} {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Language", language)
+			if w := serve(handler, r); w.Body.String() != "hello "+language {
+				t.Fatalf("expected the response for %s but got %q", language, w.Body.String())
+			}
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected each language to be cached once but the handler was called %d times", calls)
+	}
+}
+
+func TestHandlerNotModified(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(), next)
+
+	first := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	tag := first.Header().Get("ETag")
+
+	for _, match := range []string{tag, "W/" + tag, `"other", ` + tag, "*"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("If-None-Match", match)
+		w := serve(handler, r)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("expected 304 for %s but got %d %q", match, w.Code, w.Body.String())
+		}
+		if w.Header().Get("ETag") != tag || w.Header().Get("Content-Type") != "" {
+			t.Fatalf("unexpected 304 headers: %v", w.Header())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	if w := serve(handler, r); w.Code != http.StatusOK || w.Body.String() != "call 1" {
+		t.Fatalf("expected the cached response but got %d %q", w.Code, w.Body.String())
+	}
+	if *calls != 1 {
+		t.Fatalf("expected the handler to be called once but it was called %d times", *calls)
+	}
+}
+
+func TestHandlerNotModifiedOnMiss(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	})
+	handler := NewHandler(simple.NewCache(), next)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", `"v1"`)
+	if w := serve(handler, r); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 but got %d", w.Code)
+	}
+}
+
+func TestHandlerMaxBodySize(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(strings.Repeat("x", 50)))
+		w.Write([]byte(strings.Repeat("y", 50)))
+	})
+	handler := NewHandler(simple.NewCache(), next, WithMaxBodySize(64))
+
+	for i := 0; i < 2; i++ {
+		w := serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Body.String() != strings.Repeat("x", 50)+strings.Repeat("y", 50) {
+			t.Fatalf("unexpected body: %q", w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected large responses not to be cached but the handler was called %d times", calls)
+	}
+}
+
+func TestHandlerScheme(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(), next)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "https://example.com/", nil)); w.Body.String() != "call 2" {
+		t.Fatalf("expected https responses to be cached apart from http responses but got %q", w.Body.String())
+	}
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "https://example.com/", nil)); w.Body.String() != "call 2" || *calls != 2 {
+		t.Fatalf("expected the cached https response but got %q", w.Body.String())
+	}
+}
+
+func TestHandlerHeadETag(t *testing.T) {
+	next, _ := countingHandler("max-age=60")
+	handler := NewHandler(simple.NewCache(), next)
+
+	if w := serve(handler, httptest.NewRequest(http.MethodHead, "/", nil)); w.Header().Get("ETag") != "" {
+		t.Fatalf("expected HEAD responses not to be given an ETag but got %q", w.Header().Get("ETag"))
+	}
+}
+
+func TestHandlerDefaultMaxBodySize(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	large := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		w.Write(make([]byte, DefaultMaxBodySize))
+	})
+	handler := NewHandler(simple.NewCache(), large)
+
+	serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	serve(handler, httptest.NewRequest(http.MethodGet, "/", nil))
+	if *calls != 2 {
+		t.Fatalf("expected responses larger than the default size not to be cached but the handler was called %d times", *calls)
+	}
+}
+
+func TestHandlerInvalidates(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	status := http.StatusOK
+	handler := NewHandler(simple.NewCache(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Location", "/items/1")
+		w.Header().Set("Content-Location", "http://other.example.com/other")
+		w.WriteHeader(status)
+	}))
+
+	for _, target := range []string{"/items", "/items/1", "/other"} {
+		serve(handler, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	status = http.StatusBadRequest
+	serve(handler, httptest.NewRequest(http.MethodPost, "/items", nil))
+	if w := serve(handler, httptest.NewRequest(http.MethodGet, "/items", nil)); w.Body.String() != "call 1" {
+		t.Fatalf("expected failed requests not to invalidate the cache but got %q", w.Body.String())
+	}
+
+	status = http.StatusCreated
+	serve(handler, httptest.NewRequest(http.MethodPost, "/items", nil))
+	for _, tt := range []struct{ target, expected string }{
+		{"/items", "call 4"},
+		{"/items/1", "call 5"},
+		{"/other", "call 3"},
+	} {
+		if w := serve(handler, httptest.NewRequest(http.MethodGet, tt.target, nil)); w.Body.String() != tt.expected {
+			t.Fatalf("expected %q for %s after the POST but got %q", tt.expected, tt.target, w.Body.String())
+		}
+	}
+	if *calls != 5 {
+		t.Fatalf("expected 5 calls but got %d", *calls)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	next, calls := countingHandler("max-age=60")
+	server := httptest.NewServer(Middleware(simple.NewCache())(next))
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(server.URL + "/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d", resp.StatusCode)
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("expected the handler to be called once but it was called %d times", *calls)
+	}
+}
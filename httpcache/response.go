@@ -0,0 +1,173 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// responseFormat starts the status line of encoded responses, so that values
+// that are not responses are not mistaken for them.
+const responseFormat = "yacache-http/1 "
+
+var errInvalidResponse = errors.New("yacache: invalid cached response")
+
+// response is a response that is stored in the cache.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+
+	// requested and received are the times that the request for the
+	// response was sent and that the response was received, which are used
+	// by Transport to calculate the age of the response.
+	requested time.Time
+	received  time.Time
+}
+
+// encode returns the status line, headers and body of the response. The
+// format is similar to HTTP/1.1, but the body is never chunked. The status
+// line is followed by the times that the response was requested and received
+// if they are set.
+func (r response) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(responseFormat)
+	buf.WriteString(strconv.Itoa(r.status))
+	if !r.received.IsZero() {
+		fmt.Fprintf(&buf, " %d %d", r.requested.UnixNano(), r.received.UnixNano())
+	}
+	buf.WriteString("\r\n")
+	if err := r.header.Write(&buf); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	buf.Write(r.body)
+	return buf.Bytes(), nil
+}
+
+// decodeResponse decodes a response from the value of a cached item. Caches
+// that do not keep the type of values, such as redis, return strings.
+func decodeResponse(value interface{}) (response, error) {
+	var data []byte
+	switch value := value.(type) {
+	case []byte:
+		data = value
+	case string:
+		data = []byte(value)
+	default:
+		return response{}, fmt.Errorf("%w: unexpected value of type %T", errInvalidResponse, value)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, responseFormat) {
+		return response{}, errInvalidResponse
+	}
+	decoded, err := parseStatusLine(strings.TrimPrefix(line, responseFormat))
+	if err != nil {
+		return response{}, err
+	}
+
+	header, err := textproto.NewReader(reader).ReadMIMEHeader()
+	if err != nil {
+		return response{}, err
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return response{}, err
+	}
+
+	decoded.header = http.Header(header)
+	decoded.body = body
+	return decoded, nil
+}
+
+// parseStatusLine parses the status code, and the times that the response was
+// requested and received if they are present.
+func parseStatusLine(line string) (response, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 1 && len(fields) != 3 {
+		return response{}, errInvalidResponse
+	}
+
+	var (
+		r   response
+		err error
+	)
+	if r.status, err = strconv.Atoi(fields[0]); err != nil {
+		return response{}, errInvalidResponse
+	}
+	if len(fields) == 3 {
+		requested, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return response{}, errInvalidResponse
+		}
+		received, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return response{}, errInvalidResponse
+		}
+		r.requested, r.received = time.Unix(0, requested), time.Unix(0, received)
+	}
+	return r, nil
+}
+
+// etag returns a strong entity tag for a body.
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%x"`, sum[:16])
+}
+
+// notModified returns true if the conditional headers of a request match the
+// header of a response, so that a 304 Not Modified can be sent instead of the
+// body. If-None-Match is used when it is present, and If-Modified-Since
+// otherwise.
+func notModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		tag := header.Get("ETag")
+		if tag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// writeNotModified writes a 304 Not Modified response, removing the headers
+// that describe the body in the same way as net/http.
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	if header.Get("ETag") != "" {
+		header.Del("Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
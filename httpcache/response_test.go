@@ -0,0 +1,35 @@
+package httpcache
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseEncoding(t *testing.T) {
+	encoded, err := response{
+		status: http.StatusNotFound,
+		header: http.Header{"Content-Type": {"text/plain"}, "Vary": {"Accept", "Accept-Language"}},
+		body:   []byte("not found\r\n\r\n"),
+	}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Redis returns values as strings.
+	for _, value := range []interface{}{encoded, string(encoded)} {
+		decoded, err := decodeResponse(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.status != http.StatusNotFound || string(decoded.body) != "not found\r\n\r\n" {
+			t.Fatalf("unexpected response: %d %q", decoded.status, decoded.body)
+		}
+		if decoded.header.Get("Content-Type") != "text/plain" || len(decoded.header.Values("Vary")) != 2 {
+			t.Fatalf("unexpected headers: %v", decoded.header)
+		}
+	}
+
+	if _, err := decodeResponse("value"); err == nil {
+		t.Fatal("expected values that are not responses to be rejected")
+	}
+}
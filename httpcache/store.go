@@ -0,0 +1,125 @@
+package httpcache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/simple"
+)
+
+// load returns the response cached for a request's key and the item it was
+// stored in. If the response cached for the key varies on request headers,
+// the response cached for the values of the request's headers is returned.
+func load(ctx context.Context, cache yacache.Cache, key string, header http.Header) (response, yacache.Item, bool, error) {
+	cached, item, ok, err := get(ctx, cache, key)
+	if err != nil || !ok {
+		return response{}, nil, false, err
+	}
+	if names := varyNames(cached.header); len(names) > 0 {
+		return get(ctx, cache, variantKey(key, names, header))
+	}
+	return cached, item, true, nil
+}
+
+// get returns the response cached for a key.
+func get(ctx context.Context, cache yacache.Cache, key string) (response, yacache.Item, bool, error) {
+	item, ok, err := yacache.GetIfPresent(ctx, cache, simple.Key(key))
+	if err != nil || !ok || item.Error() != nil {
+		return response{}, nil, false, err
+	}
+	cached, err := decodeResponse(item.Value())
+	if err != nil {
+		return response{}, nil, false, err
+	}
+	return cached, item, true, nil
+}
+
+// save caches a response to a request for a duration. A response that varies
+// on request headers is stored under a key that includes the values of the
+// request's headers, and only its headers are stored under the request's key
+// so that the names of the headers can be found.
+func save(ctx context.Context, cache yacache.Cache, key string, header http.Header, fresh response, duration time.Duration) error {
+	if names := varyNames(fresh.header); len(names) > 0 {
+		marker := response{status: fresh.status, header: http.Header{"Vary": fresh.header.Values("Vary")}}
+		if err := set(ctx, cache, key, marker, duration); err != nil {
+			return err
+		}
+		key = variantKey(key, names, header)
+	}
+	return set(ctx, cache, key, fresh, duration)
+}
+
+func set(ctx context.Context, cache yacache.Cache, key string, cached response, duration time.Duration) error {
+	value, err := cached.encode()
+	if err != nil {
+		return err
+	}
+	return yacache.Set(ctx, cache, simple.Key(key), simple.NewCacheableValue(value, duration))
+}
+
+// safeMethods holds the methods that do not change the resources they are
+// sent to, so their responses do not invalidate cached responses.
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// invalidate removes the responses cached for the target of an unsafe
+// request that did not fail, and for the targets of its response's Location
+// and Content-Location headers that are on the same host, following RFC 9111
+// section 4.4.
+func invalidate(ctx context.Context, cache yacache.Cache, key KeyFunc, r *http.Request, status int, header http.Header) error {
+	if safeMethods[r.Method] || status < 200 || status >= 400 {
+		return nil
+	}
+
+	base := *r.URL
+	if base.Host == "" {
+		base.Host = r.Host
+	}
+	targets := []*url.URL{&base}
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if target, err := base.Parse(value); err == nil && target.Host == base.Host {
+			targets = append(targets, target)
+		}
+	}
+
+	for _, target := range targets {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			cached := r.Clone(ctx)
+			cached.Method = method
+			cached.URL = target
+			if r.RequestURI != "" {
+				cached.RequestURI = target.RequestURI()
+			}
+			if err := cache.Delete(ctx, simple.Key(key(cached))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// variantKey returns the key of the response for the values of the headers
+// that it varies on.
+func variantKey(key string, names []string, header http.Header) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		b.WriteString("|")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString("=")
+		b.WriteString(strings.Join(header.Values(name), ","))
+	}
+	return b.String()
+}
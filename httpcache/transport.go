@@ -0,0 +1,368 @@
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultStaleRetention is how long a Transport keeps responses that can be
+// revalidated after they become stale, unless WithStaleRetention is used.
+const DefaultStaleRetention = 24 * time.Hour
+
+// Transport is an http.RoundTripper that caches the responses of another
+// round tripper in a yacache.Cache, following the rules of RFC 9111 for a
+// private cache.
+//
+// Only GET requests are cached, and requests with their own conditional or
+// Range headers are passed on. Responses are fresh for their max-age
+// Cache-Control directive, until their Expires header, or for a tenth of the
+// time since their Last-Modified header. Fresh responses are returned without
+// a request. Stale responses, and responses with the no-cache directive, are
+// revalidated with If-None-Match and If-Modified-Since requests when they
+// have an ETag or Last-Modified header. Responses with the no-store directive
+// are not cached. Responses larger than DefaultMaxBodySize, or the size
+// configured with WithMaxBodySize, are not cached.
+//
+// Unsafe requests, such as POST and DELETE requests, remove the responses
+// cached for their URL and their response's Location and Content-Location
+// headers when they succeed.
+//
+// The requests of the no-store, no-cache, max-age and only-if-cached
+// directives are followed. Concurrent requests for the same response are
+// coalesced into a single request, whose response is given to each of them.
+type Transport struct {
+	cache yacache.Cache
+	next  http.RoundTripper
+	group singleflight.Group
+	config
+}
+
+// NewTransport returns a Transport that caches the responses of next. If next
+// is nil, http.DefaultTransport is used.
+func NewTransport(cache yacache.Cache, next http.RoundTripper, options ...Option) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{
+		cache:  cache,
+		next:   next,
+		config: newConfig(options),
+	}
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !safeMethods[r.Method] {
+		resp, err := t.next.RoundTrip(r)
+		if err == nil {
+			t.handleError(r, invalidate(r.Context(), t.cache, t.key, r, resp.StatusCode, resp.Header))
+		}
+		return resp, err
+	}
+	if r.Method != http.MethodGet || r.Header.Get("Range") != "" ||
+		r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return t.next.RoundTrip(r)
+	}
+	requestControl := parseCacheControl(r.Header)
+	if requestControl.has("no-store") {
+		return t.next.RoundTrip(r)
+	}
+
+	key := t.key(r)
+
+	cached, _, ok, err := load(r.Context(), t.cache, key, r.Header)
+	t.handleError(r, err)
+	if ok && !requestControl.has("no-cache") && t.fresh(cached, requestControl) {
+		return t.respond(r, cached), nil
+	}
+	if requestControl.has("only-if-cached") {
+		return newResponse(r, http.StatusGatewayTimeout, http.Header{}, nil), nil
+	}
+
+	var stale *response
+	if ok {
+		stale = &cached
+	}
+	return t.coalesce(r, key, stale)
+}
+
+// flight is the result of a request that is shared with concurrent requests.
+type flight struct {
+	fetched *response
+
+	// variant is the key of the response for the request that fetched it,
+	// which other requests must have to share the response.
+	variant string
+}
+
+// coalesce fetches the response for a request, sharing it with concurrent
+// requests for the same key. Requests that can not share the response, such
+// as because it varies on a header that they have a different value for,
+// fetch it themselves.
+func (t *Transport) coalesce(r *http.Request, key string, stale *response) (*http.Response, error) {
+	name := key
+	if stale != nil {
+		if names := varyNames(stale.header); len(names) > 0 {
+			name = variantKey(key, names, r.Header)
+		}
+	}
+
+	var (
+		leader bool
+		own    *http.Response
+	)
+	result := <-t.group.DoChan(name, func() (interface{}, error) {
+		leader = true
+		resp, fetched, err := t.fetch(r, key, stale)
+		own = resp
+		if err != nil {
+			return nil, err
+		}
+		return t.flight(r, key, fetched), nil
+	})
+
+	if leader {
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		if own != nil {
+			return own, nil
+		}
+		return t.respond(r, *result.Val.(flight).fetched), nil
+	}
+
+	if result.Err != nil {
+		// A request that was cancelled by its caller does not fail the
+		// requests that were waiting for it.
+		if (!errors.Is(result.Err, context.Canceled) && !errors.Is(result.Err, context.DeadlineExceeded)) || r.Context().Err() != nil {
+			return nil, result.Err
+		}
+	} else if shared := result.Val.(flight); shared.fetched != nil && shared.variant == t.flight(r, key, shared.fetched).variant {
+		return t.respond(r, *shared.fetched), nil
+	}
+
+	resp, fetched, err := t.fetch(r, key, stale)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+	return t.respond(r, *fetched), nil
+}
+
+func (t *Transport) flight(r *http.Request, key string, fetched *response) flight {
+	if fetched == nil {
+		return flight{}
+	}
+	return flight{fetched: fetched, variant: variantKey(key, varyNames(fetched.header), r.Header)}
+}
+
+// fetch sends a request, revalidating the stale response if there is one,
+// and caches the response. A response that can be cached is read and
+// returned as a fetched response, which can be shared. Other responses are
+// returned as they are.
+func (t *Transport) fetch(r *http.Request, key string, stale *response) (*http.Response, *response, error) {
+	outbound := r
+	if stale != nil {
+		outbound = r.Clone(r.Context())
+		if tag := stale.header.Get("ETag"); tag != "" {
+			outbound.Header.Set("If-None-Match", tag)
+		}
+		if modified := stale.header.Get("Last-Modified"); modified != "" {
+			outbound.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	requested := t.clock.Now()
+	resp, err := t.next.RoundTrip(outbound)
+	if err != nil {
+		return nil, nil, err
+	}
+	received := t.clock.Now()
+
+	if stale != nil && resp.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		revalidated := stale.revalidate(resp.Header, requested, received)
+		t.store(r, key, revalidated)
+		return nil, &revalidated, nil
+	}
+
+	fetched := response{status: resp.StatusCode, header: resp.Header, requested: requested, received: received}
+	if _, ok := t.duration(fetched); !ok {
+		return resp, nil, nil
+	}
+
+	body, complete, err := readBody(resp, t.maxBodySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !complete {
+		return resp, nil, nil
+	}
+	fetched.body = body
+
+	t.store(r, key, fetched)
+	return nil, &fetched, nil
+}
+
+// store caches a response for as long as it is fresh, and for the stale
+// retention after that if it can be revalidated.
+func (t *Transport) store(r *http.Request, key string, fetched response) {
+	if duration, ok := t.duration(fetched); ok {
+		t.handleError(r, save(r.Context(), t.cache, key, r.Header, fetched, duration))
+	}
+}
+
+// duration returns how long a response should be kept in the cache, or false
+// if it can not be cached.
+func (t *Transport) duration(fetched response) (time.Duration, bool) {
+	if !cacheableStatus[fetched.status] || parseCacheControl(fetched.header).has("no-store") {
+		return 0, false
+	}
+	for _, name := range varyNames(fetched.header) {
+		if name == "*" {
+			return 0, false
+		}
+	}
+
+	duration := t.lifetime(fetched) - fetched.age(t.clock.Now())
+	if fetched.header.Get("ETag") != "" || fetched.header.Get("Last-Modified") != "" {
+		if duration < 0 {
+			duration = 0
+		}
+		duration += t.staleRetention
+	}
+	return duration, duration > 0
+}
+
+// lifetime returns how long a response is fresh for after it was created.
+func (t *Transport) lifetime(cached response) time.Duration {
+	cc := parseCacheControl(cached.header)
+	if maxAge, ok := cc.seconds("max-age"); ok {
+		return maxAge
+	}
+
+	date := cached.received
+	if value, err := http.ParseTime(cached.header.Get("Date")); err == nil {
+		date = value
+	}
+	if value := cached.header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+
+	if t.defaultDuration > 0 {
+		return t.defaultDuration
+	}
+	if modified, err := http.ParseTime(cached.header.Get("Last-Modified")); err == nil && date.After(modified) {
+		return date.Sub(modified) / 10
+	}
+	return 0
+}
+
+// fresh returns true if a cached response can be used without revalidating
+// it.
+func (t *Transport) fresh(cached response, requestControl cacheControl) bool {
+	if parseCacheControl(cached.header).has("no-cache") {
+		return false
+	}
+	lifetime := t.lifetime(cached)
+	if maxAge, ok := requestControl.seconds("max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	return cached.age(t.clock.Now()) < lifetime
+}
+
+// respond returns a new http.Response for a cached response, with its current
+// age.
+func (t *Transport) respond(r *http.Request, cached response) *http.Response {
+	header := cached.header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(cached.age(t.clock.Now())/time.Second), 10))
+	return newResponse(r, cached.status, header, cached.body)
+}
+
+func newResponse(r *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// readBody reads and closes the body of a response. If the body is larger
+// than maxBodySize, it is not read and false is returned, and the response
+// is left to be read by the caller.
+func readBody(resp *http.Response, maxBodySize int64) ([]byte, bool, error) {
+	if maxBodySize <= 0 {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return body, err == nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, false, err
+	}
+	if int64(len(body)) > maxBodySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil, false, nil
+	}
+	resp.Body.Close()
+	return body, true, nil
+}
+
+// age returns the age of a response at now, following RFC 9111.
+func (r response) age(now time.Time) time.Duration {
+	var apparent time.Duration
+	if date, err := http.ParseTime(r.header.Get("Date")); err == nil && r.received.After(date) {
+		apparent = r.received.Sub(date)
+	}
+
+	corrected := r.received.Sub(r.requested)
+	if seconds, err := strconv.ParseInt(r.header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		corrected += time.Duration(seconds) * time.Second
+	}
+
+	if apparent > corrected {
+		corrected = apparent
+	}
+	return corrected + now.Sub(r.received)
+}
+
+// revalidate returns the response updated with the headers of a 304 Not
+// Modified response to a request to revalidate it.
+func (r response) revalidate(header http.Header, requested, received time.Time) response {
+	updated := r
+	updated.header = r.header.Clone()
+	updated.header.Del("Age")
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Content-Type", "Transfer-Encoding":
+			continue
+		}
+		updated.header[name] = values
+	}
+	updated.requested, updated.received = requested, received
+	return updated
+}
@@ -0,0 +1,301 @@
+package httpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache/cachetest"
+	"github.com/ngerakines/yacache/simple"
+)
+
+// origin is a test server that counts the requests it receives.
+type origin struct {
+	*httptest.Server
+	requests    atomic.Int32
+	conditional atomic.Int32
+}
+
+// newOrigin returns an origin that sends Date headers from the clock.
+func newOrigin(t *testing.T, clock *cachetest.FakeClock, handler http.HandlerFunc) *origin {
+	o := &origin{}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.requests.Add(1)
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			o.conditional.Add(1)
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(o.Close)
+	return o
+}
+
+func newClient(clock *cachetest.FakeClock, options ...Option) *http.Client {
+	cache := simple.NewCache(simple.WithClock(clock))
+	options = append(options, WithClock(clock))
+	return &http.Client{Transport: NewTransport(cache, nil, options...)}
+}
+
+func fetch(t *testing.T, client *http.Client, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	r, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestTransportFresh(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	for i := 0; i < 3; i++ {
+		resp, body := fetch(t, client, o.URL, nil)
+		if resp.StatusCode != http.StatusOK || body != "hello" {
+			t.Fatalf("unexpected response: %d %q", resp.StatusCode, body)
+		}
+		clock.Advance(10 * time.Second)
+	}
+	if o.requests.Load() != 1 {
+		t.Fatalf("expected 1 request to the origin but got %d", o.requests.Load())
+	}
+
+	resp, _ := fetch(t, client, o.URL, nil)
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err != nil || age != 30 {
+		t.Fatalf("expected an Age of 30 but got %q", resp.Header.Get("Age"))
+	}
+
+	clock.Advance(time.Minute)
+	fetch(t, client, o.URL, nil)
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected a stale response to be fetched again but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportRevalidatesETag(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	fetch(t, client, o.URL, nil)
+	clock.Advance(2 * time.Minute)
+
+	resp, body := fetch(t, client, o.URL, nil)
+	if resp.StatusCode != http.StatusOK || body != "hello" {
+		t.Fatalf("expected the cached response after revalidating but got %d %q", resp.StatusCode, body)
+	}
+	if o.conditional.Load() != 1 {
+		t.Fatalf("expected a conditional request but got %d", o.conditional.Load())
+	}
+
+	fetch(t, client, o.URL, nil)
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected the revalidated response to be fresh but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportRevalidatesLastModified(t *testing.T) {
+	modified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Last-Modified", modified)
+		if r.Header.Get("If-Modified-Since") == modified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	for i := 0; i < 3; i++ {
+		if _, body := fetch(t, client, o.URL, nil); body != "hello" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if o.requests.Load() != 3 || o.conditional.Load() != 2 {
+		t.Fatalf("expected no-cache responses to be revalidated, got %d requests and %d conditional", o.requests.Load(), o.conditional.Load())
+	}
+}
+
+func TestTransportNoStore(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store, max-age=60")
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	fetch(t, client, o.URL, nil)
+	fetch(t, client, o.URL, nil)
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected no-store responses not to be cached but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportRequestCacheControl(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	resp, _ := fetch(t, client, o.URL, http.Header{"Cache-Control": {"only-if-cached"}})
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504 for only-if-cached but got %d", resp.StatusCode)
+	}
+
+	fetch(t, client, o.URL, nil)
+	fetch(t, client, o.URL, http.Header{"Cache-Control": {"no-cache"}})
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected no-cache requests to go to the origin but got %d requests", o.requests.Load())
+	}
+
+	clock.Advance(20 * time.Second)
+	fetch(t, client, o.URL, http.Header{"Cache-Control": {"max-age=30"}})
+	fetch(t, client, o.URL, http.Header{"Cache-Control": {"max-age=10"}})
+	if o.requests.Load() != 3 {
+		t.Fatalf("expected the request's max-age to be followed but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportVary(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "hello %s", r.Header.Get("Accept-Language"))
+	})
+	client := newClient(clock)
+
+	for i := 0; i < 2; i++ {
+		for _, language := range []string{"en", "fr"} {
+			if _, body := fetch(t, client, o.URL, http.Header{"Accept-Language": {language}}); body != "hello "+language {
+				t.Fatalf("expected the response for %s but got %q", language, body)
+			}
+		}
+	}
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected each language to be fetched once but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportCoalesces(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { close(started) })
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "hello")
+	})
+	client := newClient(clock)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, bodies[i] = fetch(t, client, o.URL, nil)
+		}(i)
+	}
+
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, body := range bodies {
+		if body != "hello" {
+			t.Fatalf("expected every request to get the response but got %q", body)
+		}
+	}
+	if o.requests.Load() != 1 {
+		t.Fatalf("expected concurrent requests to be coalesced but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportMaxBodySize(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "a body that is too large")
+	})
+	client := newClient(clock, WithMaxBodySize(8))
+
+	for i := 0; i < 2; i++ {
+		if _, body := fetch(t, client, o.URL, nil); body != "a body that is too large" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if o.requests.Load() != 2 {
+		t.Fatalf("expected large responses not to be cached but got %d requests", o.requests.Load())
+	}
+}
+
+func TestTransportInvalidates(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	var calls atomic.Int32
+	o := newOrigin(t, clock, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/items/1")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "call %d", calls.Add(1))
+	})
+	client := newClient(clock)
+
+	fetch(t, client, o.URL+"/items", nil)
+	fetch(t, client, o.URL+"/items/1", nil)
+
+	resp, err := client.Post(o.URL+"/items", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, body := fetch(t, client, o.URL+"/items", nil); body != "call 3" {
+		t.Fatalf("expected the POST to invalidate its URL but got %q", body)
+	}
+	if _, body := fetch(t, client, o.URL+"/items/1", nil); body != "call 4" {
+		t.Fatalf("expected the POST to invalidate its Location but got %q", body)
+	}
+}
@@ -0,0 +1,48 @@
+package yacache
+
+import "context"
+
+// Inspector is implemented by caches that can report and remove everything
+// that they hold.
+type Inspector interface {
+	// Len returns the number of items in the cache.
+	Len(ctx context.Context) (int, error)
+
+	// Keys returns a page of the keys in the cache that start with prefix.
+	// An empty cursor starts at the first page, and the returned cursor is
+	// empty after the last page. The count is a hint for the size of the
+	// page.
+	Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error)
+
+	// Clear removes every item from the cache.
+	Clear(ctx context.Context) error
+}
+
+// ListedKeyDeleter is implemented by inspectors that list keys as they are
+// stored rather than as they were given to the cache, such as caches that
+// transform keys, so that the keys they list can be deleted.
+type ListedKeyDeleter interface {
+	// DeleteListedKey removes the item stored under a key returned by Keys.
+	DeleteListedKey(ctx context.Context, key string) error
+}
+
+// EachKey calls fn with each key in the cache that starts with prefix,
+// stopping at the first error.
+func EachKey(ctx context.Context, inspector Inspector, prefix string, fn func(key string) error) error {
+	cursor := ""
+	for {
+		keys, next, err := inspector.Keys(ctx, cursor, prefix, 0)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,67 @@
+package yacache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pagedInspector returns its keys two at a time.
+type pagedInspector []string
+
+func (p pagedInspector) Len(ctx context.Context) (int, error) {
+	return len(p), nil
+}
+
+func (p pagedInspector) Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error) {
+	start := 0
+	if cursor != "" {
+		start, _ = strconv.Atoi(cursor)
+	}
+	end := start + 2
+	if end >= len(p) {
+		end = len(p)
+	}
+
+	var keys []string
+	for _, key := range p[start:end] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	if end == len(p) {
+		return keys, "", nil
+	}
+	return keys, strconv.Itoa(end), nil
+}
+
+func (p pagedInspector) Clear(ctx context.Context) error {
+	return nil
+}
+
+func TestEachKey(t *testing.T) {
+	inspector := pagedInspector{"a1", "b1", "a2", "a3", "b2"}
+
+	var keys []string
+	err := EachKey(context.Background(), inspector, "a", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a1", "a2", "a3"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+
+	stop := errors.New("stop")
+	err = EachKey(context.Background(), inspector, "", func(key string) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected the callback's error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package yacache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Jitter adds a bounded random amount of time to, or removes it from, the
+// duration of cached data so that data cached at the same time does not all
+// expire at the same time. The zero value applies no jitter.
+type Jitter struct {
+	// Fraction is the largest proportion of a duration that is added or
+	// removed, for example 0.1 for up to 10%.
+	Fraction float64
+
+	// Max is the largest amount of time that is added or removed. When used
+	// with Fraction, it caps the jitter applied to long durations.
+	Max time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// SetSource sets the source of randomness, which makes the jitter applied
+// deterministic for a seeded source.
+func (j *Jitter) SetSource(source rand.Source) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.rand = rand.New(source)
+}
+
+// Apply returns the duration with jitter applied. The duration returned is
+// always positive, so the jitter is bounded by the duration itself, which
+// keeps it evenly spread around the duration.
+func (j *Jitter) Apply(duration time.Duration) time.Duration {
+	bound := time.Duration(j.Fraction * float64(duration))
+	if j.Max > 0 && (bound <= 0 || j.Max < bound) {
+		bound = j.Max
+	}
+	if bound >= duration {
+		bound = duration - 1
+	}
+	if bound <= 0 {
+		return duration
+	}
+
+	j.mu.Lock()
+	if j.rand == nil {
+		j.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	offset := time.Duration(j.rand.Int63n(int64(2*bound)+1)) - bound
+	j.mu.Unlock()
+
+	return duration + offset
+}
+
+// Cacheable returns a Cacheable with the jitter applied to its duration.
+func (j *Jitter) Cacheable(cacheable Cacheable) Cacheable {
+	if j.Fraction <= 0 && j.Max <= 0 {
+		return cacheable
+	}
+	return jitteredCacheable{
+		Cacheable: cacheable,
+		duration:  j.Apply(cacheable.Duration()),
+	}
+}
+
+type jitteredCacheable struct {
+	Cacheable
+	duration time.Duration
+}
+
+func (c jitteredCacheable) Duration() time.Duration {
+	return c.duration
+}
@@ -0,0 +1,88 @@
+package yacache
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter *Jitter
+		bound  time.Duration
+	}{
+		{"none", &Jitter{}, 0},
+		{"fraction", &Jitter{Fraction: 0.1}, 6 * time.Minute},
+		{"max", &Jitter{Max: 30 * time.Second}, 30 * time.Second},
+		{"capped fraction", &Jitter{Fraction: 0.5, Max: 1 * time.Minute}, 1 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.jitter.SetSource(rand.NewSource(1))
+
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				d := tt.jitter.Apply(1 * time.Hour)
+				if d < 1*time.Hour-tt.bound || d > 1*time.Hour+tt.bound {
+					t.Fatalf("duration %s is outside of the bound %s", d, tt.bound)
+				}
+				seen[d] = true
+			}
+			if tt.bound > 0 && len(seen) < 50 {
+				t.Fatalf("expected durations to vary but got %d distinct durations", len(seen))
+			}
+		})
+	}
+}
+
+func TestJitter_deterministic(t *testing.T) {
+	a := &Jitter{Fraction: 0.2}
+	a.SetSource(rand.NewSource(42))
+	b := &Jitter{Fraction: 0.2}
+	b.SetSource(rand.NewSource(42))
+
+	for i := 0; i < 10; i++ {
+		if da, db := a.Apply(1*time.Hour), b.Apply(1*time.Hour); da != db {
+			t.Fatalf("expected %s to equal %s", da, db)
+		}
+	}
+}
+
+func TestJitter_positive(t *testing.T) {
+	j := &Jitter{Max: 1 * time.Hour}
+	j.SetSource(rand.NewSource(1))
+
+	for i := 0; i < 100; i++ {
+		if d := j.Apply(1 * time.Second); d <= 0 {
+			t.Fatalf("expected a positive duration but got %s", d)
+		}
+	}
+}
+
+func TestJitter_distribution(t *testing.T) {
+	j := &Jitter{Max: 1 * time.Hour}
+	j.SetSource(rand.NewSource(1))
+
+	// The jitter is bounded by the duration, so the results are spread
+	// evenly between 0 and twice the duration rather than piling up on it.
+	const samples = 10000
+	var below, unchanged int
+	for i := 0; i < samples; i++ {
+		d := j.Apply(1 * time.Second)
+		if d <= 0 || d >= 2*time.Second {
+			t.Fatalf("duration %s is outside of the bound", d)
+		}
+		if d < 1*time.Second {
+			below++
+		} else if d == 1*time.Second {
+			unchanged++
+		}
+	}
+	if unchanged > samples/100 {
+		t.Fatalf("expected few durations to be unchanged but got %d of %d", unchanged, samples)
+	}
+	if below < samples*45/100 || below > samples*55/100 {
+		t.Fatalf("expected about half of the durations to be shorter but got %d of %d", below, samples)
+	}
+}
@@ -0,0 +1,50 @@
+package yacache
+
+import (
+	"context"
+	"errors"
+)
+
+// Peeker is implemented by caches that can return a cached item without
+// fetching it and without changing when the item will be evicted.
+type Peeker interface {
+	// Peek returns the item cached for a key and true, or false if the key
+	// is not cached or has expired.
+	Peek(ctx context.Context, key Key) (Item, bool, error)
+}
+
+// StalePeeker is implemented by caches that can return items that have
+// expired but have not been removed yet, such as to inspect them.
+type StalePeeker interface {
+	// PeekStale returns the item stored for a key and true, including an
+	// item that has expired, or false if no item is stored for the key. Like
+	// Peek, it does not change when the item will be evicted.
+	PeekStale(ctx context.Context, key Key) (Item, bool, error)
+}
+
+// errNotPresent is returned by the fetcher used by GetIfPresent.
+var errNotPresent = errors.New("yacache: not present")
+
+// GetIfPresent returns the item cached for a key and true, or false if the
+// key is not cached, without fetching it. Unlike Peek, the read counts as a
+// use of the item, such as for recency or sliding expiration. Caches that
+// implement Peeker are peeked first, so that a missing key is not counted as
+// a miss and does not wait for the cache to be locked to fill it.
+func GetIfPresent(ctx context.Context, cache Cache, key Key) (Item, bool, error) {
+	if peeker, ok := cache.(Peeker); ok {
+		if _, ok, err := peeker.Peek(ctx, key); err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	item, err := cache.Get(ctx, key, func(ctx context.Context, key Key) (Cacheable, error) {
+		return nil, errNotPresent
+	})
+	if errors.Is(err, errNotPresent) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return item, true, nil
+}
@@ -0,0 +1,29 @@
+package yacache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetIfPresentError(t *testing.T) {
+	_, ok, err := GetIfPresent(context.Background(), failingCache{}, nil)
+	if err == nil || ok {
+		t.Fatalf("expected the cache's error, got %v, %v", ok, err)
+	}
+}
+
+// missingCache is a cache that can only peek, and never has an item.
+type missingCache struct {
+	failingCache
+}
+
+func (missingCache) Peek(ctx context.Context, key Key) (Item, bool, error) {
+	return nil, false, nil
+}
+
+func TestGetIfPresentPeeks(t *testing.T) {
+	item, ok, err := GetIfPresent(context.Background(), missingCache{}, nil)
+	if err != nil || ok || item != nil {
+		t.Fatalf("expected the missing key to be reported without calling Get, got %v, %v, %v", item, ok, err)
+	}
+}
@@ -2,100 +2,200 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
 	"strconv"
-	"sync"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/ngerakines/yacache"
 	"github.com/ngerakines/yacache/simple"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/semaphore"
 )
 
 type purgeBehavior int8
 
 const (
-	lru = 0
-	lfa = 1
+	// purgeCached evicts the items that were cached the longest ago.
+	purgeCached purgeBehavior = 0
+
+	// purgeAccessed evicts the items that were read the longest ago.
+	purgeAccessed purgeBehavior = 1
 )
 
+// ErrNoNamespace is returned by operations on every item in a cache when the
+// cache does not have a namespace.
+var ErrNoNamespace = fmt.Errorf("yacache: cache does not have a namespace: %w", errors.ErrUnsupported)
+
+// ErrNoGenerations is returned by BumpGeneration when the cache was not
+// created with WithGenerations.
+var ErrNoGenerations = errors.New("yacache: cache does not use generations")
+
+// subscribeTimeout is how long NewCache waits for redis to confirm the
+// subscription made by WithExpiryHandler.
+const subscribeTimeout = 5 * time.Second
+
+// writeLock is the weight of the cache's lock that is acquired to change the
+// cache. Reading the cache acquires a weight of 1.
+const writeLock = 1 << 30
+
 type Cache struct {
-	redisClient   *redis.Client
+	redisClient   redis.UniversalClient
 	maxSize       int64
-	prefix        string
-	mu            sync.RWMutex
+	namespace     string
+	lock          *semaphore.Weighted
 	keyTransform  KeyTransform
 	purgeBehavior purgeBehavior
+	jitter        yacache.Jitter
+	sliding       bool
+	maxLifetime   time.Duration
+	clock         yacache.Clock
+	generations   bool
+
+	evictionCallback    yacache.EvictionCallback
+	replacementCallback yacache.EvictionCallback
+	expiryCallback      ExpiryCallback
+	expirySubscription  *redis.PubSub
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
 }
 
 const (
-	hitsMetaKey       = "yacache:keys"
+	// hitsMetaKey is the sorted set used to track items when the cache has a
+	// maximum size. Members are item keys, scored by the time they were
+	// cached (WithLRU) or last read (WithLFA), so that the index never references
+	// other keys and works when items are spread across cluster slots. It
+	// replaces the yacache:keys index of earlier versions, which was a set
+	// when using WithLRU.
+	hitsMetaKey = "yacache:index"
+
+	// generationMetaKey is the counter holding the current generation of a
+	// namespace when generations are enabled.
+	generationMetaKey = "yacache:generation"
 	valueAttribute    = "v"
 	createdAttribute  = "c"
 	durationAttribute = "d"
+	errorAttribute    = "e"
+
+	// keyAttribute is the key that was given to the cache, which is given to
+	// the eviction callback when the item is purged.
+	keyAttribute = "k"
+
+	// versionAttribute is the version of the item, which is used to make
+	// conditional writes.
+	versionAttribute = "n"
+
+	// firstCachedAttribute and windowAttribute are the time an item was
+	// first cached and the duration it was first cached for. They are
+	// written when an item's expiration slides.
+	firstCachedAttribute = "f"
+	windowAttribute      = "w"
 )
 
-// NewCache returns a new yacache.Cache that is backed by Redis.
-func NewCache(redisClient *redis.Client, options ...CacheOption) yacache.Cache {
+// NewCache returns a new yacache.Cache that is backed by Redis. The client
+// may be a single node, sentinel failover, ring or cluster client.
+func NewCache(redisClient redis.UniversalClient, options ...CacheOption) yacache.Cache {
 	cache := &Cache{
 		redisClient:   redisClient,
 		maxSize:       -1,
-		prefix:        "",
+		namespace:     "",
 		keyTransform:  DefaultKeyTransform,
-		purgeBehavior: lru,
+		purgeBehavior: purgeCached,
+		clock:         yacache.SystemClock,
+		lock:          semaphore.NewWeighted(writeLock),
 	}
 
 	for _, option := range options {
 		option(cache)
 	}
 
+	if cache.expiryCallback != nil && cache.namespace != "" {
+		cache.subscribeExpired()
+	}
+
 	return cache
 }
 
+// Close releases the keyspace notification subscription, if one was created
+// with WithExpiryHandler. The underlying redis client is not closed.
+func (c *Cache) Close() error {
+	if c.expirySubscription != nil {
+		return c.expirySubscription.Close()
+	}
+	return nil
+}
+
 func (c *Cache) Get(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) (yacache.Item, error) {
-	c.mu.RLock()
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
 
 	kv := key.Value()
-	now := time.Now()
+	now := c.clock.Now()
 
-	get, err := c.redisClient.HGetAll(c.keyTransform(kv)).Result()
+	keys, err := c.keyspace(ctx)
 	if err != nil {
-		defer c.mu.RUnlock()
+		defer c.lock.Release(1)
 		return nil, err
 	}
-	if getValue, ok := get[valueAttribute]; ok {
-		defer c.mu.RUnlock()
-		if c.maxSize > 0 && c.purgeBehavior == lfa {
-			_, err = c.redisClient.ZAddXX(c.keyTransform(hitsMetaKey), redis.Z{Score: float64(now.UnixNano()), Member: c.keyTransform(kv)}).Result()
-			if err != nil {
-				return nil, err
-			}
-		}
 
-		createdInt, err := strconv.ParseInt(get[createdAttribute], 10, 64)
+	get, err := c.redisClient.HGetAll(ctx, keys.item(kv)).Result()
+	if err != nil {
+		defer c.lock.Release(1)
+		return nil, err
+	}
+	if _, ok := get[valueAttribute]; ok {
+		item, err := c.itemFromHash(get)
 		if err != nil {
+			defer c.lock.Release(1)
 			return nil, err
 		}
-		created := time.Unix(0, createdInt)
 
-		if err != nil {
-			return nil, err
-		}
-		dur, err := time.ParseDuration(get[durationAttribute])
+		if !item.Expired() {
+			defer c.lock.Release(1)
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if c.maxSize > 0 && c.purgeBehavior == purgeAccessed {
+				_, err = c.redisClient.ZAddXX(ctx, keys.index(), redis.Z{Score: float64(now.UnixNano()), Member: keys.item(kv)}).Result()
+				if err != nil {
+					return nil, err
+				}
+			}
 
-		return simple.NewItem(getValue, created, dur), nil
+			c.hits.Add(1)
+			if c.sliding {
+				return c.slide(ctx, keys, kv, get, now)
+			}
+			return item, nil
+		}
 	}
 
-	c.mu.RUnlock()
+	c.lock.Release(1)
+	c.misses.Add(1)
 	// NKG: Right here. This is the danger zone.
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return nil, err
+	}
+	defer c.lock.Release(writeLock)
+
+	// The generation may have changed while waiting for the lock.
+	if keys, err = c.keyspace(ctx); err != nil {
+		return nil, err
+	}
 
-	item, err := c.getAndSet(ctx, key, fetcher)
+	item, err := c.getAndSet(ctx, keys, key, fetcher)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = c.clearExtra(); err != nil {
+	if err = c.clearExtra(ctx, keys); err != nil {
 		return nil, err
 	}
 
@@ -103,115 +203,607 @@ func (c *Cache) Get(ctx context.Context, key yacache.Key, fetcher yacache.Fetche
 }
 
 func (c *Cache) Put(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
 
-	_, err := c.getAndSet(ctx, key, fetcher)
+	keys, err := c.keyspace(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err = c.clearExtra(); err != nil {
+	if _, err = c.getAndSet(ctx, keys, key, fetcher); err != nil {
+		return err
+	}
+
+	if err = c.clearExtra(ctx, keys); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// Set stores a cacheable for a key, replacing any item already cached for the
+// key.
+func (c *Cache) Set(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err = c.set(ctx, keys, key.Value(), cacheable); err != nil {
+		return err
+	}
+
+	return c.clearExtra(ctx, keys)
+}
+
 func (c *Cache) Contains(ctx context.Context, key yacache.Key) (bool, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	if err := c.acquire(ctx, 1); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	get, err := c.redisClient.HGetAll(ctx, keys.item(key.Value())).Result()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := get[valueAttribute]; !ok {
+		return false, nil
+	}
+
+	item, err := c.itemFromHash(get)
+	if err != nil {
+		return false, err
+	}
+	return !item.Expired(), nil
+}
+
+// Peek returns the item cached for a key without fetching it and without
+// changing when it will be evicted or when it expires.
+func (c *Cache) Peek(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	return c.peek(ctx, key, false)
+}
+
+// PeekStale returns the item stored for a key, including an item that has
+// expired by the cache's clock but has not been expired by redis yet.
+func (c *Cache) PeekStale(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	return c.peek(ctx, key, true)
+}
+
+// peek returns the item stored for a key, or false if there is no item or it
+// has expired and stale is false.
+func (c *Cache) peek(ctx context.Context, key yacache.Key, stale bool) (yacache.Item, bool, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.Release(1)
 
-	return c.redisClient.HExists(c.keyTransform(key.Value()), valueAttribute).Result()
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	get, err := c.redisClient.HGetAll(ctx, keys.item(key.Value())).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := get[valueAttribute]; !ok {
+		return nil, false, nil
+	}
+
+	item, err := c.itemFromHash(get)
+	if err != nil {
+		return nil, false, err
+	}
+	if !stale && item.Expired() {
+		return nil, false, nil
+	}
+	return item, true, nil
 }
 
 func (c *Cache) Delete(ctx context.Context, key yacache.Key) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
 
-	kv := key.Value()
+	return c.delete(ctx, func(keys keyspace) string {
+		return keys.item(key.Value())
+	})
+}
 
-	_, err := c.redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-		pipeliner.Del(c.keyTransform(kv))
-		if c.maxSize > 0 && c.purgeBehavior == lru {
-			pipeliner.SRem(c.keyTransform(hitsMetaKey), c.keyTransform(kv))
-		} else if c.maxSize > 0 && c.purgeBehavior == lru {
-			pipeliner.ZRem(c.keyTransform(hitsMetaKey), c.keyTransform(kv))
+// DeleteListedKey removes the item stored under a key returned by Keys. Keys
+// that were changed by a custom KeyTransform are returned by Keys as they
+// were transformed, so they are not transformed again.
+func (c *Cache) DeleteListedKey(ctx context.Context, key string) error {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	return c.delete(ctx, func(keys keyspace) string {
+		return keys.listed(key)
+	})
+}
+
+// delete removes the item stored under the redis key returned by redisKey
+// and its index entry.
+func (c *Cache) delete(ctx context.Context, redisKey func(keys keyspace) string) error {
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return err
+	}
+
+	item := redisKey(keys)
+	_, err = c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.Del(ctx, item)
+		if c.maxSize > 0 {
+			pipeliner.ZRem(ctx, keys.index(), item)
 		}
 		return nil
 	})
 	return err
 }
 
-func (c *Cache) getAndSet(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) (yacache.Item, error) {
-	kv := key.Value()
-	now := time.Now()
+// acquire waits for the cache's lock, returning the context's error if it is
+// done before the lock is acquired.
+func (c *Cache) acquire(ctx context.Context, weight int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.lock.Acquire(ctx, weight)
+}
 
+func (c *Cache) getAndSet(ctx context.Context, keys keyspace, key yacache.Key, fetcher yacache.Fetcher) (yacache.Item, error) {
 	cacheable, err := fetcher(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 
-	item := simple.ItemFromCacheable(cacheable)
-	_, err = c.redisClient.Pipelined(func(pipe redis.Pipeliner) error {
-		pipe.HMSet(c.keyTransform(kv), map[string]interface{}{
-			valueAttribute:    item.Value(),
-			createdAttribute:  item.Cached().UnixNano(),
-			durationAttribute: item.Duration().String(),
-		})
-		pipe.Expire(c.keyTransform(kv), item.Duration())
-		if c.maxSize > 0 && c.purgeBehavior == lru {
-			pipe.SAdd(c.keyTransform(hitsMetaKey), c.keyTransform(kv))
-		} else if c.maxSize > 0 && c.purgeBehavior == lfa {
-			pipe.ZAdd(c.keyTransform(hitsMetaKey), redis.Z{Score: float64(now.UnixNano()), Member: c.keyTransform(kv)})
+	// The fetcher may have returned a result despite the context being
+	// cancelled, which should not be cached.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.set(ctx, keys, key.Value(), cacheable)
+}
+
+// set stores a cacheable, replacing the fields of any item already stored for
+// the key. The replaced item is only loaded if there is a replacement
+// callback configured.
+func (c *Cache) set(ctx context.Context, keys keyspace, kv string, cacheable yacache.Cacheable) (yacache.Item, error) {
+	now := c.clock.Now()
+
+	var replaced yacache.Item
+	if c.replacementCallback != nil {
+		get, err := c.redisClient.HGetAll(ctx, keys.item(kv)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := get[valueAttribute]; ok {
+			if replaced, err = c.itemFromHash(get); err != nil {
+				return nil, err
+			}
+			if replaced.Expired() {
+				replaced = nil
+			}
+		}
+	}
+
+	item, fields := c.newItem(kv, cacheable)
+
+	_, err := c.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys.item(kv))
+		pipe.HSet(ctx, keys.item(kv), fields)
+		pipe.PExpire(ctx, keys.item(kv), item.Duration())
+		if c.maxSize > 0 {
+			pipe.ZAdd(ctx, keys.index(), redis.Z{Score: float64(now.UnixNano()), Member: keys.item(kv)})
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	if replaced != nil {
+		c.replacementCallback(simple.Key(kv), replaced)
+	}
 	return item, nil
 }
 
-func (c *Cache) clearExtra() error {
-	var keys []string
-	//var count int64
-	var err error
+// clearExtra purges the items beyond the maximum size, starting with those
+// that have the lowest score in the index. Each item is deleted on its own so
+// that the purge works when the items are on different cluster slots.
+func (c *Cache) clearExtra(ctx context.Context, keys keyspace) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	// The index is ranked from the highest score, so the entries ranked from
+	// the maximum size on are the oldest.
+	purged, err := c.redisClient.ZRevRange(ctx, keys.index(), c.maxSize, -1).Result()
+	if err != nil {
+		return err
+	}
+	if len(purged) == 0 {
+		return nil
+	}
+
+	evicted, err := c.evictedItems(ctx, keys, purged)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for _, key := range purged {
+			pipeliner.Del(ctx, key)
+		}
+		members := make([]interface{}, len(purged))
+		for i, key := range purged {
+			members[i] = key
+		}
+		pipeliner.ZRem(ctx, keys.index(), members...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.evictions.Add(uint64(len(purged)))
+	for _, key := range purged {
+		if evicted, ok := evicted[key]; ok {
+			c.evictionCallback(evicted.key, evicted.item)
+		}
+	}
+	return nil
+}
+
+// evictedItem is an item that is about to be purged and the key it was
+// given to the cache with.
+type evictedItem struct {
+	key  yacache.Key
+	item yacache.Item
+}
+
+// evictedItems loads the items that are about to be purged so that they can
+// be given to the eviction callback. Nothing is loaded if there is no
+// callback configured.
+func (c *Cache) evictedItems(ctx context.Context, keys keyspace, purged []string) (map[string]evictedItem, error) {
+	items := make(map[string]evictedItem)
+	if c.evictionCallback == nil {
+		return items, nil
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(purged))
+	_, err := c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for i, key := range purged {
+			cmds[i] = pipeliner.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		get := cmd.Val()
+		if _, ok := get[valueAttribute]; !ok {
+			continue
+		}
+		item, err := c.itemFromHash(get)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := get[keyAttribute]
+		if !ok {
+			key = keys.untransform(purged[i])
+		}
+		items[purged[i]] = evictedItem{key: simple.Key(key), item: item}
+	}
+	return items, nil
+}
+
+// subscribeExpired listens for expired keyspace events in the database that
+// the client is using and reports keys belonging to this cache to the
+// eviction callback. The redis server must have keyspace notifications
+// enabled for expired events (e.g. "notify-keyspace-events Ex").
+func (c *Cache) subscribeExpired() {
+	channel := fmt.Sprintf("__keyevent@%d__:expired", database(c.redisClient))
+	c.expirySubscription = c.redisClient.PSubscribe(context.Background(), channel)
+
+	// Wait for the subscription to be confirmed so that expirations right
+	// after the cache is created are not missed. If redis does not confirm
+	// it in time, the subscription is still made once redis is reachable.
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	c.expirySubscription.Receive(ctx)
+
+	go func() {
+		for message := range c.expirySubscription.Channel() {
+			c.expired(message.Payload)
+		}
+	}()
+}
+
+func (c *Cache) expired(key string) {
+	ctx := context.Background()
+
+	keys, ok := c.keyspaceOf(key)
+	if !ok || key == keys.index() {
+		return
+	}
+
+	c.expirations.Add(1)
+
 	if c.maxSize > 0 {
-		switch c.purgeBehavior {
-		case lru:
-			keys, err = c.redisClient.Sort(c.keyTransform(hitsMetaKey), &redis.Sort{
-				By:     "*->c",
-				Offset: c.maxSize,
-				Count:  -1,
-			}).Result()
-			if err != nil {
-				return err
-			}
-		case lfa:
-			keys, err = c.redisClient.ZRevRange(c.keyTransform(hitsMetaKey), c.maxSize, -1).Result()
-			if err != nil {
-				return err
-			}
+		c.lock.Acquire(ctx, writeLock)
+		c.redisClient.ZRem(ctx, keys.index(), key)
+		c.lock.Release(writeLock)
+	}
+
+	c.expiryCallback(simple.Key(keys.untransform(key)))
+}
+
+// database returns the database number that a client uses. Cluster clients
+// always use database 0.
+func database(client redis.UniversalClient) int {
+	switch client := client.(type) {
+	case *redis.Client:
+		return client.Options().DB
+	case *redis.Ring:
+		return client.Options().DB
+	default:
+		return 0
+	}
+}
+
+// Stats returns the cache's counters. Items purged by other clients sharing
+// the namespace are not counted.
+func (c *Cache) Stats() yacache.Stats {
+	return yacache.Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// BumpGeneration invalidates every item in the cache's namespace by moving
+// the namespace to a new generation. Items of older generations are no
+// longer used and are removed by redis when they expire.
+func (c *Cache) BumpGeneration(ctx context.Context) error {
+	if !c.generations {
+		return ErrNoGenerations
+	}
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		pipeliner.Incr(ctx, c.generationKey())
+		pipeliner.Del(ctx, keys.index())
+		return nil
+	})
+	return err
+}
+
+// keyspace returns the keys of the cache's current generation.
+func (c *Cache) keyspace(ctx context.Context) (keyspace, error) {
+	keys := keyspace{transform: c.keyTransform}
+	if c.namespace != "" {
+		keys.prefix = c.namespace + ":"
+	}
+	if !c.generations {
+		return keys, nil
+	}
+
+	generation, err := c.redisClient.Get(ctx, c.generationKey()).Result()
+	if err == redis.Nil {
+		generation = "0"
+	} else if err != nil {
+		return keyspace{}, err
+	}
+	keys.prefix += generation + ":"
+	return keys, nil
+}
+
+// keyspaceOf returns the keys of the namespace and generation that a redis
+// key belongs to. False is returned if the key is not one of the cache's,
+// which is always the case when the cache does not have a namespace because
+// its keys cannot be told apart from others in the database.
+func (c *Cache) keyspaceOf(key string) (keyspace, bool) {
+	if c.namespace == "" || !strings.HasPrefix(key, c.namespace+":") {
+		return keyspace{}, false
+	}
+	keys := keyspace{prefix: c.namespace + ":", transform: c.keyTransform}
+	if !c.generations {
+		return keys, true
+	}
+
+	rest := key[len(keys.prefix):]
+	end := strings.Index(rest, ":")
+	if end < 0 {
+		return keyspace{}, false
+	}
+	if _, err := strconv.ParseUint(rest[:end], 10, 64); err != nil {
+		return keyspace{}, false
+	}
+	keys.prefix += rest[:end+1]
+	return keys, true
+}
+
+// generationKey returns the key of the counter holding the cache's current
+// generation.
+func (c *Cache) generationKey() string {
+	if c.namespace == "" {
+		return generationMetaKey
+	}
+	return c.namespace + ":" + generationMetaKey
+}
+
+// slideScript refreshes the expiration of an item if it still exists and its
+// version field, named by ARGV[2], is still ARGV[1], which is empty for items
+// stored without a version. The fields in the rest of ARGV are set and the
+// item expires after ARGV[3] milliseconds. It returns 1 if the item was
+// refreshed.
+var slideScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 or (redis.call('HGET', KEYS[1], ARGV[2]) or '') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// slide refreshes the expiration of an item that was just read. The item is
+// only changed if it has not been removed or replaced since it was read.
+func (c *Cache) slide(ctx context.Context, keys keyspace, kv string, get map[string]string, now time.Time) (yacache.Item, error) {
+	firstField, windowField := firstCachedAttribute, windowAttribute
+	if _, ok := get[firstField]; !ok {
+		firstField, windowField = createdAttribute, durationAttribute
+	}
+
+	first, err := parseCached(get[firstField])
+	if err != nil {
+		return nil, err
+	}
+	window, err := time.ParseDuration(get[windowField])
+	if err != nil {
+		return nil, err
+	}
+
+	duration := simple.SlidingDuration(first, window, now, c.maxLifetime)
+	if duration <= 0 {
+		return c.itemFromHash(get)
+	}
+
+	slid, err := slideScript.Run(ctx, c.redisClient, []string{keys.item(kv)},
+		get[versionAttribute], versionAttribute, milliseconds(duration),
+		createdAttribute, now.UnixNano(),
+		durationAttribute, duration.String(),
+		firstCachedAttribute, first.UnixNano(),
+		windowAttribute, window.String(),
+	).Int()
+	if err != nil {
+		return nil, err
+	}
+	if slid == 0 {
+		// The item expired, was deleted or was replaced after it was read.
+		return c.itemFromHash(get)
+	}
+
+	if c.maxSize > 0 && c.purgeBehavior == purgeCached {
+		err = c.redisClient.ZAddXX(ctx, keys.index(), redis.Z{Score: float64(now.UnixNano()), Member: keys.item(kv)}).Err()
+		if err != nil {
+			return nil, err
 		}
 	}
-	if len(keys) > 0 {
-		_, err = c.redisClient.Pipelined(func(pipeliner redis.Pipeliner) error {
-			pipeliner.Del(keys...)
-			if c.maxSize > 0 && c.purgeBehavior == lru {
-				for _, score := range keys {
-					pipeliner.SRem(c.keyTransform(hitsMetaKey), score)
-				}
-			} else if c.maxSize > 0 && c.purgeBehavior == lfa {
-				for _, score := range keys {
-					pipeliner.ZRem(c.keyTransform(hitsMetaKey), score)
-				}
-			}
-			return nil
-		})
+
+	options, err := c.itemOptions(get)
+	if err != nil {
+		return nil, err
+	}
+	if errorValue, ok := get[errorAttribute]; ok {
+		return simple.NewErrorItem(errors.New(errorValue), now, duration, options...), nil
+	}
+	return simple.NewItem(get[valueAttribute], now, duration, options...), nil
+}
+
+func (c *Cache) itemFromHash(get map[string]string) (yacache.Item, error) {
+	created, err := parseCached(get[createdAttribute])
+	if err != nil {
+		return nil, err
+	}
+
+	dur, err := time.ParseDuration(get[durationAttribute])
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := c.itemOptions(get)
+	if err != nil {
+		return nil, err
+	}
+	if errorValue, ok := get[errorAttribute]; ok {
+		return simple.NewErrorItem(errors.New(errorValue), created, dur, options...), nil
+	}
+	return simple.NewItem(get[valueAttribute], created, dur, options...), nil
+}
+
+// itemOptions returns the options for an item loaded from a hash. Items
+// stored before versions were added have a version of 0.
+func (c *Cache) itemOptions(get map[string]string) ([]simple.ItemOption, error) {
+	options := []simple.ItemOption{simple.WithItemClock(c.clock)}
+	if value, ok := get[versionAttribute]; ok {
+		version, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		options = append(options, simple.WithItemVersion(version))
 	}
-	return nil
+	return options, nil
+}
+
+// newItem returns the item for a cacheable, with a new version, and the hash
+// fields to store it with.
+func (c *Cache) newItem(kv string, cacheable yacache.Cacheable) (yacache.Item, map[string]interface{}) {
+	version := newVersion()
+	item := simple.ItemFromCacheable(c.jitter.Cacheable(cacheable), simple.WithItemClock(c.clock), simple.WithItemVersion(version))
+	fields := map[string]interface{}{
+		keyAttribute:      kv,
+		valueAttribute:    item.Value(),
+		createdAttribute:  item.Cached().UnixNano(),
+		durationAttribute: item.Duration().String(),
+		versionAttribute:  strconv.FormatUint(version, 10),
+	}
+	if item.Error() != nil {
+		fields[errorAttribute] = item.Error().Error()
+	}
+	return item, fields
+}
+
+// newVersion returns a random, non-zero version for an item. Versions are
+// random so that clients do not need to coordinate to create them.
+func newVersion() uint64 {
+	for {
+		if version := rand.Uint64(); version != 0 {
+			return version
+		}
+	}
+}
+
+// milliseconds returns a duration in whole milliseconds for PEXPIRE, rounded
+// up so that durations under a millisecond do not delete the key.
+func milliseconds(duration time.Duration) int64 {
+	return int64((duration + time.Millisecond - 1) / time.Millisecond)
+}
+
+func parseCached(value string) (time.Time, error) {
+	cachedInt, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, cachedInt), nil
 }
@@ -1,9 +1,19 @@
 package redis
 
-import "fmt"
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
 
 type CacheOption func(cache *Cache) error
 
+// WithMaxSize configures the maximum number of items in the cache. Items are
+// tracked in a sorted set in the namespace, named yacache:index. Earlier
+// versions tracked them in yacache:keys, which is no longer used and can be
+// deleted after upgrading. Items stored before upgrading are not tracked, and
+// are removed when they expire rather than when the cache is full.
 func WithMaxSize(size int64) func(cache *Cache) error {
 	return func(cache *Cache) error {
 		cache.maxSize = size
@@ -11,25 +21,158 @@ func WithMaxSize(size int64) func(cache *Cache) error {
 	}
 }
 
+// WithLRU configures a cache with a maximum size to evict the items that
+// were cached the longest ago, which is the default. Despite the name, the
+// order is first in, first out: reading an item does not change when it is
+// evicted, except when its expiration slides. Use WithLFA to evict the items
+// that were read the longest ago.
 func WithLRU() func(cache *Cache) error {
 	return func(cache *Cache) error {
-		cache.purgeBehavior = lru
+		cache.purgeBehavior = purgeCached
 		return nil
 	}
 }
 
+// WithLFA configures a cache with a maximum size to evict the items that were
+// last accessed the longest ago, which adds a redis command to each read.
 func WithLFA() func(cache *Cache) error {
 	return func(cache *Cache) error {
-		cache.purgeBehavior = lfa
+		cache.purgeBehavior = purgeAccessed
+		return nil
+	}
+}
+
+// WithNamespace configures the cache to store items and the keys used to
+// track them under keys that start with the name, so that caches with
+// different namespaces can share a redis database. The name is used as a
+// redis cluster hash tag, so that all of the namespace's keys are in the same
+// slot, unless the name already contains a hash tag.
+func WithNamespace(name string) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.namespace = hashTag(name)
 		return nil
 	}
 }
 
+// WithPrefix configures the cache to store items and the keys used to track
+// them under keys that start with the prefix and a colon. Unlike
+// WithNamespace, the prefix is not used as a redis cluster hash tag, which
+// keeps the "prefix:key" layout of items stored by earlier versions of the
+// cache. Switching an existing cache from WithPrefix to WithNamespace stores
+// items under new keys, and the items stored under the old keys are not used
+// again and are removed by redis when they expire.
 func WithPrefix(prefix string) func(cache *Cache) error {
 	return func(cache *Cache) error {
-		cache.keyTransform = func(key string) string {
-			return fmt.Sprintf("%s:%s", prefix, key)
-		}
+		cache.namespace = prefix
+		return nil
+	}
+}
+
+// WithGenerations configures the cache to store items under a generation of
+// its namespace, so that BumpGeneration can invalidate every item at once.
+// Keys are built as "namespace:generation:key". Reading the generation adds a
+// redis command to each operation.
+func WithGenerations() func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.generations = true
+		return nil
+	}
+}
+
+// WithKeyTransform configures the function used to change keys before they
+// are stored. The namespace is added to keys after they are transformed.
+func WithKeyTransform(transform KeyTransform) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.keyTransform = transform
+		return nil
+	}
+}
+
+// WithEvictionHandler configures the eviction callback function for the
+// cache. The callback is called for items purged by this client to stay
+// within the maximum size, and is always given the purged item. Use
+// WithExpiryHandler to be told about items that redis expires.
+func WithEvictionHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.evictionCallback = callback
+		return nil
+	}
+}
+
+// WithReplacementHandler configures a callback that is called with the item
+// that was replaced when an item is stored for a key that is already cached.
+// Setting an item reads the item it replaces when a callback is configured.
+func WithReplacementHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.replacementCallback = callback
+		return nil
+	}
+}
+
+// ExpiryCallback is a function that is called with the key of an item that
+// redis expired. The item's data is gone by the time redis reports it, so
+// only the key is given.
+type ExpiryCallback func(key yacache.Key)
+
+// WithExpiryHandler subscribes to redis keyspace notifications so that the
+// callback is called when items expire. The redis server must be configured
+// to publish expired events, for example with "notify-keyspace-events Ex".
+// Notifications are only used by caches with a namespace, because without one
+// the cache's keys cannot be told apart from the other keys in the database.
+func WithExpiryHandler(callback ExpiryCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.expiryCallback = callback
+		return nil
+	}
+}
+
+// WithJitter configures the cache to add or remove up to a fraction of the
+// duration of items when they are stored, for example 0.1 for up to 10%, so
+// that items cached at the same time do not all expire at the same time.
+func WithJitter(fraction float64) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.Fraction = fraction
+		return nil
+	}
+}
+
+// WithJitterDuration configures the cache to add or remove up to max from the
+// duration of items when they are stored. When used with WithJitter, it caps
+// the jitter applied to long durations.
+func WithJitterDuration(max time.Duration) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.Max = max
+		return nil
+	}
+}
+
+// WithJitterSource configures the source of randomness used to apply jitter,
+// which makes it deterministic for a seeded source.
+func WithJitterSource(source rand.Source) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.SetSource(source)
+		return nil
+	}
+}
+
+// WithSlidingExpiration configures the cache to reset the expiration of items
+// each time they are returned by Get, so that items stay cached for as long
+// as they continue to be used. The Cached time of an item is the time that it
+// was last refreshed. Items expire no later than maxLifetime after they were
+// first cached, unless maxLifetime is 0.
+func WithSlidingExpiration(maxLifetime time.Duration) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.sliding = true
+		cache.maxLifetime = maxLifetime
+		return nil
+	}
+}
+
+// WithClock configures the clock used to record when items are cached and to
+// decide if they have expired. Redis still expires items using its own clock.
+func WithClock(clock yacache.Clock) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.clock = clock
 		return nil
 	}
 }
@@ -2,15 +2,22 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/ngerakines/yacache/cachetest"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/ngerakines/yacache"
 	"github.com/ngerakines/yacache/simple"
+	"github.com/redis/go-redis/v9"
 )
 
 var (
@@ -21,15 +28,16 @@ var (
 type testHelper interface {
 	Helper()
 	Fatal(args ...interface{})
+	Cleanup(func())
 }
 
 func init() {
-	flag.StringVar(&redisHost, "redis.host", "localhost:6379", "The redis host to test against.")
+	flag.StringVar(&redisHost, "redis.host", "", "The redis host to test against. An in-process fake is used if not set.")
 	flag.BoolVar(&redisDebug, "redis.debug", false, "Do debug stuff with the redis client.")
 }
 
 func TestCache(t *testing.T) {
-	redisClient := redisClient(t, 1)
+	redisClient, _ := redisClient(t, 1)
 
 	c := NewCache(redisClient, WithMaxSize(5))
 
@@ -43,12 +51,54 @@ func TestCache(t *testing.T) {
 	cachetest.Standard(t, c, key, key2, fetcher)
 }
 
+func TestCacheSuite(t *testing.T) {
+	cachetest.RunSuite(t, func(t *testing.T, config cachetest.Config) yacache.Cache {
+		redisClient, _ := redisClient(t, 1)
+		return NewCache(
+			redisClient,
+			WithPrefix("TestCacheSuite"),
+			WithMaxSize(int64(config.MaxSize)),
+			WithLFA(),
+			WithEvictionHandler(config.EvictionCallback),
+			WithReplacementHandler(config.ReplacementCallback),
+			WithClock(config.Clock),
+		)
+	})
+}
+
 func TestCacheWithPrefix(t *testing.T) {
-	redisClient := redisClient(t, 1)
+	redisClient, _ := redisClient(t, 1)
 
 	c := NewCache(
 		redisClient,
 		WithPrefix("what"),
+		WithMaxSize(5),
+	)
+
+	key := simple.Key("foo")
+	key2 := simple.Key("bar")
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	cachetest.Standard(t, c, key, key2, fetcher)
+
+	// Prefixed caches keep the layout of earlier versions of the cache.
+	ctx := context.Background()
+	if exists := redisClient.Exists(ctx, "what:bar", "what:yacache:index").Val(); exists != 2 {
+		t.Fatalf("expected the item and index to be stored under the prefix but %d were", exists)
+	}
+}
+
+func TestCacheClusterClient(t *testing.T) {
+	client, cluster := clusterClient(t, 3)
+
+	c := NewCache(
+		client,
+		WithNamespace("TestCacheClusterClient"),
+		WithMaxSize(5),
+		WithLFA(),
 	)
 
 	key := simple.Key("foo")
@@ -59,6 +109,119 @@ func TestCacheWithPrefix(t *testing.T) {
 	}
 
 	cachetest.Standard(t, c, key, key2, fetcher)
+
+	if len(cluster.Keys()) == 0 {
+		t.Fatal("expected the cache to have stored keys")
+	}
+	for _, k := range cluster.Keys() {
+		if !strings.HasPrefix(k, "{TestCacheClusterClient}") {
+			t.Errorf("expected key %s to use the prefix hash tag", k)
+		}
+	}
+}
+
+func TestCacheClusterSuite(t *testing.T) {
+	purgeBehaviors := map[string]CacheOption{
+		"lru": WithLRU(),
+		"lfa": WithLFA(),
+	}
+	for name, purgeBehavior := range purgeBehaviors {
+		t.Run(name, func(t *testing.T) {
+			cachetest.RunSuite(t, func(t *testing.T, config cachetest.Config) yacache.Cache {
+				client, _ := clusterClient(t, 3)
+				return NewCache(
+					client,
+					WithMaxSize(int64(config.MaxSize)),
+					purgeBehavior,
+					WithEvictionHandler(config.EvictionCallback),
+					WithReplacementHandler(config.ReplacementCallback),
+					WithClock(config.Clock),
+				)
+			})
+		})
+	}
+}
+
+func TestFakeCluster(t *testing.T) {
+	ctx := context.Background()
+
+	for key, slot := range map[string]int{"foo": 12182, "bar": 5061, "{user1000}.following": 3443, "user1000": 3443} {
+		if s := keySlot(key); s != slot {
+			t.Errorf("expected %s to be in slot %d but got %d", key, slot, s)
+		}
+	}
+
+	client, cluster := clusterClient(t, 3)
+
+	if err := client.Set(ctx, "foo", "a", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Set(ctx, "bar", "b", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !cluster[2].Exists("foo") || !cluster[0].Exists("bar") {
+		t.Fatal("expected keys to be stored on the nodes that serve their slots")
+	}
+
+	// A node that does not serve a key's slot redirects to the one that does.
+	direct := redis.NewClient(&redis.Options{Addr: cluster[0].Addr()})
+	defer direct.Close()
+	if err := direct.Get(ctx, "foo").Err(); err == nil || !strings.HasPrefix(err.Error(), "MOVED 12182 ") {
+		t.Fatalf("expected a MOVED error but got %v", err)
+	}
+
+	if err := client.Del(ctx, "foo", "bar").Err(); err == nil || !strings.HasPrefix(err.Error(), "CROSSSLOT") {
+		t.Fatalf("expected a CROSSSLOT error but got %v", err)
+	}
+	if err := client.Del(ctx, "{bar}:a", "{bar}:b", "bar").Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheClusterMaxSize(t *testing.T) {
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	client, cluster := clusterClient(t, 3)
+
+	// Without a prefix the items are spread across the nodes, away from the
+	// index.
+	c := NewCache(client, WithMaxSize(5), WithLRU())
+
+	cachetest.MaxSize(t, c, fetcher, func(s string) yacache.Key {
+		return simple.Key(s)
+	})
+
+	nodes := 0
+	for _, node := range cluster {
+		if len(node.Keys()) > 0 {
+			nodes++
+		}
+	}
+	if nodes < 2 {
+		t.Errorf("expected keys on more than one node, got %d", nodes)
+	}
+
+	// The five items and the index.
+	if keys := cluster.Keys(); len(keys) != 6 {
+		t.Errorf("expected 6 keys, got %d: %v", len(keys), keys)
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	tests := map[string]string{
+		"users":       "{users}",
+		"{users}":     "{users}",
+		"app:{users}": "app:{users}",
+		"{}users":     "{{}users}",
+		"users}{":     "{users}{}",
+	}
+	for value, expected := range tests {
+		if got := hashTag(value); got != expected {
+			t.Errorf("hashTag(%q) = %q, expected %q", value, got, expected)
+		}
+	}
 }
 
 func TestCacheMaxSize_lru(t *testing.T) {
@@ -66,7 +229,7 @@ func TestCacheMaxSize_lru(t *testing.T) {
 		return simple.NewCacheableValue("value", 1*time.Hour), nil
 	}
 
-	redisClient := redisClient(t, 1)
+	redisClient, _ := redisClient(t, 1)
 
 	c := NewCache(
 		redisClient,
@@ -84,7 +247,7 @@ func TestCacheMaxSize_lfa(t *testing.T) {
 		return simple.NewCacheableValue("value", 1*time.Hour), nil
 	}
 
-	redisClient := redisClient(t, 3)
+	redisClient, _ := redisClient(t, 3)
 
 	c := NewCache(
 		redisClient,
@@ -97,6 +260,852 @@ func TestCacheMaxSize_lfa(t *testing.T) {
 	})
 }
 
+func TestCacheEvictionOrder(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	tests := []struct {
+		name          string
+		purgeBehavior CacheOption
+		evictions     string
+	}{
+		{"lru", WithLRU(), "[a b c]"},
+		{"lfa", WithLFA(), "[b c]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisClient, _ := redisClient(t, 1)
+			clock := cachetest.NewFakeClock(time.Now())
+
+			evictions := []string{}
+			evictionCB := func(key yacache.Key, item yacache.Item) {
+				evictions = append(evictions, key.Value())
+			}
+
+			c := NewCache(
+				redisClient,
+				WithNamespace("TestCacheEvictionOrder"),
+				WithMaxSize(2),
+				tt.purgeBehavior,
+				WithEvictionHandler(evictionCB),
+				WithClock(clock))
+
+			for _, k := range []string{"a", "b", "a", "c", "a", "d"} {
+				clock.Advance(time.Second)
+				if _, err := c.Get(ctx, simple.Key(k), fetcher); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if fmt.Sprint(evictions) != tt.evictions {
+				t.Fatalf("expected evictions %s but got %v", tt.evictions, evictions)
+			}
+		})
+	}
+}
+
+func TestCacheEvictionHandler(t *testing.T) {
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	purgeBehaviors := map[string]CacheOption{
+		"lru": WithLRU(),
+		"lfa": WithLFA(),
+	}
+	for name, purgeBehavior := range purgeBehaviors {
+		t.Run(name, func(t *testing.T) {
+			evictions := []string{}
+			evictionCB := func(key yacache.Key, item yacache.Item) {
+				if item == nil || item.Value() != "value" {
+					t.Errorf("unexpected item evicted for key %s: %v", key, item)
+				}
+				evictions = append(evictions, key.Value())
+			}
+
+			redisClient, _ := redisClient(t, 1)
+
+			c := NewCache(
+				redisClient,
+				WithMaxSize(5),
+				purgeBehavior,
+				WithPrefix("TestCacheEvictionHandler"),
+				WithEvictionHandler(evictionCB))
+
+			cachetest.MaxSize(t, c, fetcher, func(s string) yacache.Key {
+				return simple.Key(s)
+			})
+			if len(evictions) != 10 {
+				t.Fatalf("expected 10 evictions but there was %d", len(evictions))
+			}
+			for i, e := range []int{10, 9, 8, 7, 6, 1, 2, 3, 4, 5} {
+				if strconv.Itoa(e) != evictions[i] {
+					t.Fatalf("expected eviction at %d to be %d but got %s", i, e, evictions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCacheNamespaces(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	redisClient, _ := redisClient(t, 1)
+
+	users := NewCache(redisClient, WithNamespace("users"), WithMaxSize(3), WithLRU()).(*Cache)
+	orders := NewCache(redisClient, WithNamespace("orders"), WithMaxSize(5), WithLFA()).(*Cache)
+
+	for i := 0; i < 10; i++ {
+		key := simple.Key(strconv.Itoa(i))
+		if _, err := users.Get(ctx, key, fetcher); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orders.Get(ctx, key, fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := orders.Get(ctx, simple.Key("9"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+
+	for cache, expected := range map[*Cache]int{users: 3, orders: 5} {
+		size, err := cache.Len(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != expected {
+			t.Errorf("expected %s to have %d items, got %d", cache.namespace, expected, size)
+		}
+	}
+
+	stats := orders.Stats()
+	if stats.Hits != 1 || stats.Misses != 10 || stats.Evictions != 5 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if err := users.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := users.Len(ctx); err != nil || size != 0 {
+		t.Errorf("expected flushed namespace to be empty, got %d: %v", size, err)
+	}
+	if size, err := orders.Len(ctx); err != nil || size != 5 {
+		t.Errorf("expected other namespace to keep 5 items, got %d: %v", size, err)
+	}
+}
+
+func TestCacheNamespaceGlob(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	redisClient, _ := redisClient(t, 1)
+
+	glob := NewCache(redisClient, WithNamespace("a*")).(*Cache)
+	other := NewCache(redisClient, WithNamespace("ab")).(*Cache)
+
+	if _, err := other.Get(ctx, simple.Key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := glob.Len(ctx); err != nil || size != 0 {
+		t.Fatalf("expected the namespace to be empty but got %d: %v", size, err)
+	}
+	if keys, _, err := glob.Keys(ctx, "", "", 0); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys but got %v: %v", keys, err)
+	}
+	if err := glob.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := other.Len(ctx); err != nil || size != 1 {
+		t.Fatalf("expected the other namespace to keep its item but got %d: %v", size, err)
+	}
+}
+
+func TestCachePrefixCluster(t *testing.T) {
+	client, _ := clusterClient(t, 3)
+
+	c := NewCache(client, WithPrefix("TestCachePrefixCluster")).(*Cache)
+	if _, err := c.Len(context.Background()); err == nil {
+		t.Fatal("expected scanning a prefix spread across a cluster to fail")
+	}
+
+	tagged := NewCache(client, WithPrefix("{TestCachePrefixCluster}")).(*Cache)
+	if _, err := tagged.Len(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheNamespaceRequired(t *testing.T) {
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(redisClient).(*Cache)
+	if _, err := c.Len(context.Background()); !errors.Is(err, ErrNoNamespace) {
+		t.Errorf("expected ErrNoNamespace, got %v", err)
+	}
+	if err := c.Flush(context.Background()); !errors.Is(err, ErrNoNamespace) {
+		t.Errorf("expected ErrNoNamespace, got %v", err)
+	}
+}
+
+func TestCacheKeyTransform(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	var evictions []string
+	evictionCB := func(key yacache.Key, item yacache.Item) {
+		evictions = append(evictions, key.Value())
+	}
+
+	redisClient, fake := redisClient(t, 1)
+
+	c := NewCache(
+		redisClient,
+		WithKeyTransform(strings.ToUpper),
+		WithNamespace("TestCacheKeyTransform"),
+		WithMaxSize(1),
+		WithEvictionHandler(evictionCB),
+	)
+
+	for _, key := range []string{"foo", "bar"} {
+		if _, err := c.Get(ctx, simple.Key(key), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fake != nil && !fake.Exists("{TestCacheKeyTransform}:BAR") {
+		t.Errorf("expected the namespace to be added to the transformed key, got %v", fake.Keys())
+	}
+	if len(evictions) != 1 || evictions[0] != "foo" {
+		t.Errorf("expected foo to be evicted, got %v", evictions)
+	}
+}
+
+func TestCacheDeleteListedKey(t *testing.T) {
+	ctx := context.Background()
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(
+		redisClient,
+		WithKeyTransform(func(key string) string { return "user:" + key }),
+		WithNamespace("TestCacheDeleteListedKey"),
+		WithMaxSize(10),
+	).(*Cache)
+	if err := c.Set(ctx, simple.Key("foo"), simple.NewCacheableValue("value", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, _, err := c.Keys(ctx, "", "", 0)
+	if err != nil || len(keys) != 1 || keys[0] != "user:foo" {
+		t.Fatalf("expected the transformed key to be listed but got %v: %v", keys, err)
+	}
+	if err := c.DeleteListedKey(ctx, keys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Contains(ctx, simple.Key("foo")); err != nil || ok {
+		t.Fatalf("expected the listed key to be deleted: %v", err)
+	}
+	if count, err := c.IndexLen(ctx); err != nil || count != 0 {
+		t.Fatalf("expected the index entry to be removed but got %d: %v", count, err)
+	}
+}
+
+func TestCacheClusterFlush(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	client, cluster := clusterClient(t, 3)
+
+	users := NewCache(client, WithNamespace("users"), WithMaxSize(10)).(*Cache)
+	orders := NewCache(client, WithNamespace("orders")).(*Cache)
+
+	for i := 0; i < 5; i++ {
+		key := simple.Key(strconv.Itoa(i))
+		if _, err := users.Get(ctx, key, fetcher); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orders.Get(ctx, key, fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if size, err := users.Len(ctx); err != nil || size != 5 {
+		t.Errorf("expected 5 items, got %d: %v", size, err)
+	}
+	if err := users.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if keys := cluster.Keys(); len(keys) != 5 {
+		t.Errorf("expected only the other namespace's keys to remain, got %v", keys)
+	}
+}
+
+func TestCacheBumpGeneration(t *testing.T) {
+	ctx := context.Background()
+
+	fetches := 0
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		fetches++
+		return simple.NewCacheableValue(strconv.Itoa(fetches), 1*time.Hour), nil
+	}
+
+	redisClient, fake := redisClient(t, 1)
+
+	users := NewCache(redisClient, WithNamespace("users"), WithGenerations(), WithMaxSize(5)).(*Cache)
+	orders := NewCache(redisClient, WithNamespace("orders"), WithGenerations()).(*Cache)
+
+	yacache.EnsureCacheGet(users, ctx, simple.Key("foo"), fetcher)
+	yacache.EnsureCacheGet(orders, ctx, simple.Key("foo"), fetcher)
+
+	if fake != nil && !fake.Exists("{users}:0:foo") {
+		t.Errorf("expected the key to include the generation, got %v", fake.Keys())
+	}
+
+	if err := users.BumpGeneration(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if yacache.EnsureCacheContains(users, ctx, simple.Key("foo")) {
+		t.Fatal("expected the item to be invalidated")
+	}
+	if size, err := users.Len(ctx); err != nil || size != 0 {
+		t.Errorf("expected the new generation to be empty, got %d: %v", size, err)
+	}
+	if !yacache.EnsureCacheContains(orders, ctx, simple.Key("foo")) {
+		t.Fatal("expected the other namespace to be kept")
+	}
+
+	item := yacache.EnsureCacheGet(users, ctx, simple.Key("foo"), fetcher)
+	if item.Value() != "3" {
+		t.Fatalf("expected the item to be fetched again, got %v", item.Value())
+	}
+	if fake != nil && (!fake.Exists("{users}:1:foo") || fake.Exists("{users}:0:yacache:index")) {
+		t.Errorf("expected only the new generation to be indexed, got %v", fake.Keys())
+	}
+
+	// Another client sharing the namespace sees the new generation.
+	other := NewCache(redisClient, WithNamespace("users"), WithGenerations())
+	item = yacache.EnsureCacheGet(other, ctx, simple.Key("foo"), fetcher)
+	if item.Value() != "3" {
+		t.Fatalf("expected the item of the current generation, got %v", item.Value())
+	}
+
+	if err := NewCache(redisClient).(*Cache).BumpGeneration(ctx); err != ErrNoGenerations {
+		t.Errorf("expected ErrNoGenerations, got %v", err)
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	client, _ := clusterClient(t, 3)
+
+	c := NewCache(client, WithNamespace("TestCacheKeys"), WithGenerations(), WithMaxSize(10)).(*Cache)
+
+	for _, key := range []string{"old", "a*", "ab"} {
+		yacache.EnsureCacheGet(c, ctx, simple.Key(key), fetcher)
+		if key == "old" {
+			if err := c.BumpGeneration(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var keys []string
+	err := yacache.EachKey(ctx, c, "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a*,ab" {
+		t.Errorf("expected the keys of the current generation, got %v", keys)
+	}
+
+	keys, _, err = c.Keys(ctx, "", "a*", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "a*" {
+		t.Errorf("expected the prefix to be matched literally, got %v", keys)
+	}
+
+	if _, _, err := c.Keys(ctx, "nope", "", 0); err == nil {
+		t.Error("expected an invalid cursor to be an error")
+	}
+}
+
+func TestCachePeek(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(redisClient, WithNamespace("TestCachePeek"), WithMaxSize(2), WithLFA()).(*Cache)
+	yacache.EnsureCacheGet(c, ctx, simple.Key("foo"), fetcher)
+	yacache.EnsureCacheGet(c, ctx, simple.Key("bar"), fetcher)
+
+	item, ok, err := c.Peek(ctx, simple.Key("foo"))
+	if err != nil || !ok || item.Value() != "value" {
+		t.Fatalf("expected the item, got %v, %v: %v", item, ok, err)
+	}
+	if stats := c.Stats(); stats.Hits != 0 {
+		t.Errorf("expected peeking not to count as a hit, got %+v", stats)
+	}
+
+	// Peeking does not make foo more recently used than bar.
+	yacache.EnsureCacheGet(c, ctx, simple.Key("baz"), fetcher)
+	if yacache.EnsureCacheContains(c, ctx, simple.Key("foo")) {
+		t.Fatal("expected the least recently used item to be evicted")
+	}
+}
+
+func TestCacheConflictingClients(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := redisClient(t, 1)
+
+	// Each cache has its own lock, like caches in different processes, so
+	// only redis keeps their writes from conflicting.
+	var replaced atomic.Int64
+	caches := make([]*Cache, 4)
+	for i := range caches {
+		caches[i] = NewCache(
+			redisClient,
+			WithNamespace("TestCacheConflictingClients"),
+			WithMaxSize(10),
+			WithReplacementHandler(func(key yacache.Key, item yacache.Item) {
+				replaced.Add(1)
+			}),
+		).(*Cache)
+	}
+
+	if _, err := caches[0].SetIfAbsent(ctx, simple.Key("counter"), simple.NewCacheableValue("0", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range caches {
+		wg.Add(1)
+		go func(c *Cache) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				for {
+					item, ok, err := c.Peek(ctx, simple.Key("counter"))
+					if err != nil || !ok {
+						t.Errorf("expected the counter to be cached: %v", err)
+						return
+					}
+					n, _ := strconv.Atoi(item.Value().(string))
+					stored, err := c.SetIfVersion(ctx, simple.Key("counter"), simple.NewCacheableValue(strconv.Itoa(n+1), time.Hour), item.(yacache.Versioned).Version())
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if stored {
+						break
+					}
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	item, _, err := caches[0].Peek(ctx, simple.Key("counter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Value() != "100" {
+		t.Errorf("expected every increment to be kept, got %v", item.Value())
+	}
+	if replaced.Load() != 100 {
+		t.Errorf("expected 100 replacements, got %d", replaced.Load())
+	}
+}
+
+func TestCacheInspect(t *testing.T) {
+	ctx := context.Background()
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(redisClient, WithNamespace("TestCacheInspect"), WithMaxSize(10)).(*Cache)
+	if err := c.Set(ctx, simple.Key("foo"), simple.NewCacheableValue("bar", time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	fields, ok, err := c.Inspect(ctx, "foo")
+	if err != nil || !ok {
+		t.Fatalf("expected the item to be found: %v", err)
+	}
+	if fields.RedisKey != "{TestCacheInspect}:foo" || fields.Key != "foo" || fields.Value != "bar" || fields.HasError {
+		t.Fatalf("unexpected fields: %+v", fields)
+	}
+	if fields.Duration != time.Hour || fields.Version == 0 || fields.TTL <= 0 || !fields.Indexed {
+		t.Fatalf("unexpected fields: %+v", fields)
+	}
+	// Scores are floats, so they lose the precision of nanoseconds.
+	if diff := fields.IndexScore.Sub(fields.Cached); diff < -time.Millisecond || diff > time.Millisecond {
+		t.Fatalf("expected the item to be scored by when it was cached: %+v", fields)
+	}
+
+	if _, ok, err := c.Inspect(ctx, "missing"); err != nil || ok {
+		t.Fatalf("expected a missing item not to be found: %v", err)
+	}
+}
+
+func TestCacheLegacyIndex(t *testing.T) {
+	ctx := context.Background()
+	redisClient, _ := redisClient(t, 1)
+
+	// Earlier versions tracked items with WithLRU in a set.
+	if err := redisClient.SAdd(ctx, "{TestCacheLegacyIndex}:yacache:keys", "{TestCacheLegacyIndex}:a").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCache(redisClient, WithNamespace("TestCacheLegacyIndex"), WithMaxSize(1), WithLRU()).(*Cache)
+	for _, key := range []string{"a", "b"} {
+		if err := c.Set(ctx, simple.Key(key), simple.NewCacheableValue("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := c.IndexLen(ctx); err != nil || count != 1 {
+		t.Fatalf("expected 1 index entry but got %d: %v", count, err)
+	}
+}
+
+func TestCacheOrphans(t *testing.T) {
+	ctx := context.Background()
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(redisClient, WithNamespace("TestCacheOrphans"), WithMaxSize(10)).(*Cache)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, simple.Key(key), simple.NewCacheableValue("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Items expired by redis leave their entries in the index.
+	if err := redisClient.Del(ctx, "{TestCacheOrphans}:b").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.Index(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Key != "{TestCacheOrphans}:a" {
+		t.Fatalf("expected the index in eviction order but got %+v", entries)
+	}
+
+	orphans, err := c.Orphans(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].Key != "{TestCacheOrphans}:b" {
+		t.Fatalf("unexpected orphans: %+v", orphans)
+	}
+
+	if removed, err := c.RemoveOrphans(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected 1 orphan to be removed but got %d: %v", removed, err)
+	}
+	if count, err := c.IndexLen(ctx); err != nil || count != 2 {
+		t.Fatalf("expected 2 index entries but got %d: %v", count, err)
+	}
+}
+
+func TestCacheOrphansCluster(t *testing.T) {
+	ctx := context.Background()
+	client, _ := clusterClient(t, 3)
+
+	c := NewCache(client, WithMaxSize(10)).(*Cache)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Set(ctx, simple.Key(key), simple.NewCacheableValue("value", time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Del(ctx, "b").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := c.RemoveOrphans(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected 1 orphan to be removed but got %d: %v", removed, err)
+	}
+	if count, err := c.IndexLen(ctx); err != nil || count != 2 {
+		t.Fatalf("expected 2 index entries but got %d: %v", count, err)
+	}
+}
+
+func TestCacheExpiryNotifications(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Second), nil
+	}
+
+	expired := make(chan yacache.Key, 1)
+	expiryCB := func(key yacache.Key) {
+		expired <- key
+	}
+
+	redisClient, fake := redisClient(t, 1)
+	if fake == nil {
+		if err := redisClient.ConfigSet(ctx, "notify-keyspace-events", "Ex").Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewCache(
+		redisClient,
+		WithPrefix("TestCacheExpiryNotifications"),
+		WithEvictionHandler(func(key yacache.Key, item yacache.Item) {
+			t.Errorf("unexpected eviction of %s", key)
+		}),
+		WithExpiryHandler(expiryCB))
+	defer c.(*Cache).Close()
+
+	if err := c.Put(ctx, simple.Key("foo"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if fake != nil {
+		fake.FastForward(2 * time.Second)
+	}
+
+	select {
+	case key := <-expired:
+		if key.Value() != "foo" {
+			t.Fatalf("unexpected key expired: %s", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected key to expire")
+	}
+}
+
+func TestCacheExpiryNotificationsNamespaceRequired(t *testing.T) {
+	redisClient, _ := redisClient(t, 1)
+
+	expiryCB := func(key yacache.Key) {
+		t.Errorf("unexpected expiration of %s", key)
+	}
+
+	c := NewCache(redisClient, WithExpiryHandler(expiryCB)).(*Cache)
+	defer c.Close()
+
+	if c.expirySubscription != nil {
+		t.Fatal("expected a cache without a namespace not to subscribe to expirations")
+	}
+	if _, ok := c.keyspaceOf("foo"); ok {
+		t.Fatal("expected keys not to belong to a cache without a namespace")
+	}
+}
+
+func TestCacheJitter(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(
+		redisClient,
+		WithPrefix("TestCacheJitter"),
+		WithJitterDuration(5*time.Minute),
+		WithJitterSource(rand.NewSource(1)))
+
+	durations := map[time.Duration]bool{}
+	for i := 0; i < 10; i++ {
+		key := simple.Key(strconv.Itoa(i))
+		item, err := c.Get(ctx, key, fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Duration() < 55*time.Minute || item.Duration() > 65*time.Minute {
+			t.Fatalf("duration %s is outside of the jitter bound", item.Duration())
+		}
+		durations[item.Duration()] = true
+
+		ttl, err := redisClient.TTL(ctx, "TestCacheJitter:"+key.Value()).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl > item.Duration() || ttl < item.Duration()-time.Minute {
+			t.Fatalf("expected ttl %s to match duration %s", ttl, item.Duration())
+		}
+
+		cached, err := c.Get(ctx, key, fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached.Duration() != item.Duration() {
+			t.Fatalf("expected cached duration %s to be %s", cached.Duration(), item.Duration())
+		}
+	}
+	if len(durations) < 2 {
+		t.Fatal("expected durations to vary")
+	}
+}
+
+func TestCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return simple.NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	redisClient, _ := redisClient(t, 1)
+	clock := cachetest.NewFakeClock(time.Now())
+
+	c := NewCache(
+		redisClient,
+		WithPrefix("TestCacheSlidingExpiration"),
+		WithSlidingExpiration(90*time.Minute),
+		WithClock(clock))
+
+	first, err := c.Get(ctx, simple.Key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(20 * time.Minute)
+
+	item, err := c.Get(ctx, simple.Key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !item.Cached().Equal(clock.Now()) {
+		t.Fatal("expected the cached time to be refreshed")
+	}
+	if item.Duration() != 1*time.Hour {
+		t.Fatalf("expected duration to be 1h but got %s", item.Duration())
+	}
+	if f := redisClient.HGet(ctx, "TestCacheSlidingExpiration:foo", firstCachedAttribute).Val(); f != strconv.FormatInt(first.Cached().UnixNano(), 10) {
+		t.Fatalf("expected the first cached time to be kept but got %s", f)
+	}
+
+	capped := NewCache(
+		redisClient,
+		WithPrefix("TestCacheSlidingExpiration"),
+		WithSlidingExpiration(1*time.Hour),
+		WithClock(clock))
+
+	item, err = capped.Get(ctx, simple.Key("foo"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Duration() != 40*time.Minute {
+		t.Fatalf("expected duration to be limited by the max lifetime but got %s", item.Duration())
+	}
+	if expires := item.Cached().Add(item.Duration()); expires.UnixNano() != first.Cached().Add(1*time.Hour).UnixNano() {
+		t.Fatalf("expected item to expire at %s but got %s", first.Cached().Add(1*time.Hour), expires)
+	}
+}
+
+func TestCacheSlidingExpiration_removed(t *testing.T) {
+	ctx := context.Background()
+
+	redisClient, _ := redisClient(t, 1)
+	clock := cachetest.NewFakeClock(time.Now())
+
+	c := NewCache(
+		redisClient,
+		WithNamespace("TestCacheSlidingExpiration_removed"),
+		WithSlidingExpiration(0),
+		WithClock(clock)).(*Cache)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, simple.Key("foo"), simple.NewCacheableValue("value", 1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	get, err := redisClient.HGetAll(ctx, keys.item("foo")).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The item is removed after it was read but before its expiration slides.
+	if err := c.Delete(ctx, simple.Key("foo")); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Minute)
+	if _, err := c.slide(ctx, keys, "foo", get, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if exists := redisClient.Exists(ctx, keys.item("foo")).Val(); exists != 0 {
+		t.Fatal("expected sliding a removed item not to recreate it")
+	}
+
+	// The item is replaced after it was read.
+	if err := c.Set(ctx, simple.Key("foo"), simple.NewCacheableValue("replaced", 1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.slide(ctx, keys, "foo", get, clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if f := redisClient.HExists(ctx, keys.item("foo"), firstCachedAttribute).Val(); f {
+		t.Fatal("expected sliding a replaced item not to change it")
+	}
+}
+
+func TestCacheSetIfAbsent_shortDuration(t *testing.T) {
+	ctx := context.Background()
+	redisClient, _ := redisClient(t, 1)
+
+	c := NewCache(redisClient, WithNamespace("TestCacheSetIfAbsent_shortDuration")).(*Cache)
+
+	stored, err := c.SetIfAbsent(ctx, simple.Key("foo"), simple.NewCacheableValue("value", 500*time.Microsecond))
+	if err != nil || stored {
+		t.Fatalf("expected an item shorter than a millisecond not to be stored, got %v: %v", stored, err)
+	}
+
+	stored, err = c.SetIfAbsent(ctx, simple.Key("foo"), simple.NewCacheableValue("value", 1500*time.Microsecond))
+	if err != nil || !stored {
+		t.Fatalf("expected the item to be stored, got %v: %v", stored, err)
+	}
+	if ttl := redisClient.PTTL(ctx, "{TestCacheSetIfAbsent_shortDuration}:foo").Val(); ttl != 2*time.Millisecond {
+		t.Fatalf("expected the expiration to be rounded up to 2ms but got %s", ttl)
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	tests := map[time.Duration]int64{
+		0:                       0,
+		time.Nanosecond:         1,
+		time.Millisecond:        1,
+		time.Millisecond + 1:    2,
+		1500 * time.Microsecond: 2,
+		time.Second:             1000,
+	}
+	for duration, expected := range tests {
+		if ms := milliseconds(duration); ms != expected {
+			t.Errorf("expected %s to be %dms but got %d", duration, expected, ms)
+		}
+	}
+}
+
 func BenchmarkCacheGet(b *testing.B) {
 	ctx := context.Background()
 
@@ -104,7 +1113,7 @@ func BenchmarkCacheGet(b *testing.B) {
 		return simple.NewCacheableValue("value", 1*time.Hour), nil
 	}
 
-	redisClient := redisClient(b, 2)
+	redisClient, _ := redisClient(b, 2)
 	c := NewCache(redisClient)
 
 	for i := 0; i < b.N; i++ {
@@ -122,7 +1131,7 @@ func BenchmarkCacheGet_maxSize_lru(b *testing.B) {
 		return simple.NewCacheableValue("value", 1*time.Hour), nil
 	}
 
-	redisClient := redisClient(b, 2)
+	redisClient, _ := redisClient(b, 2)
 
 	c := NewCache(
 		redisClient,
@@ -144,7 +1153,7 @@ func BenchmarkCacheGet_maxSize_lfa(b *testing.B) {
 		return simple.NewCacheableValue("value", 1*time.Hour), nil
 	}
 
-	redisClient := redisClient(b, 2)
+	redisClient, _ := redisClient(b, 2)
 
 	c := NewCache(
 		redisClient,
@@ -159,31 +1168,93 @@ func BenchmarkCacheGet_maxSize_lfa(b *testing.B) {
 	}
 }
 
-func redisClient(t testHelper, db int) *redis.Client {
+// redisClient returns a client for an empty database. The in-process fake is
+// also returned unless the tests are running against the redis server given
+// with -redis.host.
+func redisClient(t testHelper, db int) (*redis.Client, *fakeRedis) {
 	t.Helper()
+
+	addr := redisHost
+	var fake *fakeRedis
+	if addr == "" {
+		var err error
+		fake, err = newFakeRedis()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(fake.Close)
+
+		// The fake only publishes expired events for the default database,
+		// and each test gets its own fake anyway.
+		addr = fake.Addr()
+		db = 0
+	}
+
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: redisHost,
+		Addr: addr,
 		DB:   db,
 	})
+	t.Cleanup(func() {
+		redisClient.Close()
+	})
 	if redisDebug {
-		redisClient.WrapProcess(func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
-			return func(cmd redis.Cmder) error {
-				fmt.Printf("starting processing: <%s>\n", cmd)
-				err := old(cmd)
-				fmt.Printf("finished processing: <%s>\n", cmd)
-				return err
-			}
-		})
+		redisClient.AddHook(debugHook{})
 	}
 
-	_, err := redisClient.Ping().Result()
+	_, err := redisClient.Ping(context.Background()).Result()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = redisClient.FlushAll().Result()
+	_, err = redisClient.FlushAll(context.Background()).Result()
 	if err != nil {
 		t.Fatal(err)
 	}
-	return redisClient
+	return redisClient, fake
+}
+
+// debugHook prints the commands sent to redis.
+type debugHook struct{}
+
+func (debugHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (debugHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		fmt.Printf("starting processing: <%s>\n", cmd)
+		err := next(ctx, cmd)
+		fmt.Printf("finished processing: <%s>\n", cmd)
+		return err
+	}
+}
+
+func (debugHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		fmt.Printf("starting processing: <%s>\n", cmds)
+		err := next(ctx, cmds)
+		fmt.Printf("finished processing: <%s>\n", cmds)
+		return err
+	}
+}
+
+// clusterClient returns a cluster client for a new fake cluster with the
+// given number of nodes.
+func clusterClient(t testHelper, nodes int) (*redis.ClusterClient, fakeCluster) {
+	t.Helper()
+
+	cluster, err := newFakeCluster(nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+
+	client := cluster.Client()
+	t.Cleanup(func() {
+		client.Close()
+	})
+	if redisDebug {
+		client.AddHook(debugHook{})
+	}
+	return client, cluster
 }
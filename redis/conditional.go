@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/simple"
+	"github.com/redis/go-redis/v9"
+)
+
+// setIfScript replaces an item when its version field, named by ARGV[2], is
+// ARGV[1], or when the item does not exist and ARGV[1] is empty. The item is
+// stored with the fields in the rest of ARGV and expires after ARGV[3]
+// milliseconds. The fields of the replaced item are returned, or nil if the
+// item was not stored.
+var setIfScript = redis.NewScript(`
+if ARGV[1] == '' then
+	if redis.call('EXISTS', KEYS[1]) == 1 then
+		return false
+	end
+elseif redis.call('HGET', KEYS[1], ARGV[2]) ~= ARGV[1] then
+	return false
+end
+local replaced = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return replaced
+`)
+
+// deleteIfScript deletes an item when its version field, named by ARGV[2], is
+// ARGV[1]. It returns 1 if the item was deleted.
+var deleteIfScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[2]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// SetIfAbsent stores a cacheable if no item is stored for the key in redis.
+// It returns true if the cacheable was stored. Cacheables with a duration of
+// less than a millisecond, the precision of redis expirations, are not
+// stored.
+func (c *Cache) SetIfAbsent(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) (bool, error) {
+	return c.setIf(ctx, key, cacheable, "")
+}
+
+// SetIfVersion stores a cacheable if the item cached for the key has the
+// version. It returns true if the cacheable was stored. The version is
+// checked and the item is replaced atomically by redis. As with SetIfAbsent,
+// cacheables with a duration of less than a millisecond are not stored.
+func (c *Cache) SetIfVersion(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable, version uint64) (bool, error) {
+	return c.setIf(ctx, key, cacheable, strconv.FormatUint(version, 10))
+}
+
+// DeleteIfVersion removes the item cached for the key if it has the version.
+// It returns true if the item was removed.
+func (c *Cache) DeleteIfVersion(ctx context.Context, key yacache.Key, version uint64) (bool, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(writeLock)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	kv := key.Value()
+	deleted, err := deleteIfScript.Run(ctx, c.redisClient, []string{keys.item(kv)}, strconv.FormatUint(version, 10), versionAttribute).Int()
+	if err != nil || deleted == 0 {
+		return false, err
+	}
+
+	if c.maxSize > 0 {
+		if err := c.redisClient.ZRem(ctx, keys.index(), keys.item(kv)).Err(); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// setIf stores a cacheable if the item's version is expected, or if there is
+// no item and expected is empty.
+func (c *Cache) setIf(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable, expected string) (bool, error) {
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(writeLock)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	kv := key.Value()
+	now := c.clock.Now()
+	item, fields := c.newItem(kv, cacheable)
+	if item.Duration() < time.Millisecond {
+		// Redis can not expire the item with this precision.
+		return false, nil
+	}
+
+	args := []interface{}{expected, versionAttribute, milliseconds(item.Duration())}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	replaced, err := setIfScript.Run(ctx, c.redisClient, []string{keys.item(kv)}, args...).StringSlice()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if c.maxSize > 0 {
+		err = c.redisClient.ZAdd(ctx, keys.index(), redis.Z{Score: float64(now.UnixNano()), Member: keys.item(kv)}).Err()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	if c.replacementCallback != nil && len(replaced) > 0 {
+		get := make(map[string]string, len(replaced)/2)
+		for i := 0; i+1 < len(replaced); i += 2 {
+			get[replaced[i]] = replaced[i+1]
+		}
+		if previous, err := c.itemFromHash(get); err == nil && !previous.Expired() {
+			c.replacementCallback(simple.Key(kv), previous)
+		}
+	}
+
+	return true, c.clearExtra(ctx, keys)
+}
@@ -0,0 +1,261 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IndexEntry is an entry of the sorted set that orders a cache's items for
+// eviction.
+type IndexEntry struct {
+	// Key is the redis key that the item is stored under.
+	Key string
+
+	// Score is the time that the item was cached (WithLRU) or last read (WithLFA).
+	Score time.Time
+}
+
+// ItemFields are the fields of the hash that an item is stored in, for
+// debugging. Fields that are missing or can not be parsed are left empty,
+// and are available as they are stored in Raw.
+type ItemFields struct {
+	// RedisKey is the redis key that the item is stored under.
+	RedisKey string
+
+	// Key is the key that was given to the cache, which is empty for items
+	// stored before it was recorded.
+	Key         string
+	Value       string
+	Error       string
+	HasError    bool
+	Cached      time.Time
+	Duration    time.Duration
+	FirstCached time.Time
+	Window      time.Duration
+	Version     uint64
+
+	// TTL is the time until redis expires the item, or a negative duration
+	// if it does not have an expiration.
+	TTL time.Duration
+
+	// Indexed is true if the item has an entry in the index, which has the
+	// IndexScore.
+	Indexed    bool
+	IndexScore time.Time
+
+	Raw map[string]string
+}
+
+// orphanScript removes ARGV[1] from the index in KEYS[1] if the item in
+// KEYS[2] does not exist. It returns 1 if the entry was removed. Both keys
+// must be in the same slot of a cluster.
+var orphanScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+return redis.call('ZREM', KEYS[1], ARGV[1])
+`)
+
+// MaxSize returns the maximum number of items configured with WithMaxSize, or
+// a negative number if the cache does not have a maximum size.
+func (c *Cache) MaxSize() int64 {
+	return c.maxSize
+}
+
+// Inspect returns the fields of the hash that the item for a key is stored
+// in, its expiration and its index entry. False is returned if the key is not
+// stored.
+func (c *Cache) Inspect(ctx context.Context, key string) (ItemFields, bool, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return ItemFields{}, false, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return ItemFields{}, false, err
+	}
+	redisKey := keys.item(key)
+
+	var (
+		get   *redis.MapStringStringCmd
+		ttl   *redis.DurationCmd
+		score *redis.FloatCmd
+	)
+	_, err = c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		get = pipeliner.HGetAll(ctx, redisKey)
+		ttl = pipeliner.PTTL(ctx, redisKey)
+		score = pipeliner.ZScore(ctx, keys.index(), redisKey)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return ItemFields{}, false, err
+	}
+	if len(get.Val()) == 0 {
+		return ItemFields{}, false, nil
+	}
+
+	raw := get.Val()
+	fields := ItemFields{
+		RedisKey: redisKey,
+		Key:      raw[keyAttribute],
+		Value:    raw[valueAttribute],
+		TTL:      ttl.Val(),
+		Raw:      raw,
+	}
+	fields.Error, fields.HasError = raw[errorAttribute]
+	fields.Cached, _ = parseCached(raw[createdAttribute])
+	fields.Duration, _ = time.ParseDuration(raw[durationAttribute])
+	if value, ok := raw[firstCachedAttribute]; ok {
+		fields.FirstCached, _ = parseCached(value)
+	}
+	if value, ok := raw[windowAttribute]; ok {
+		fields.Window, _ = time.ParseDuration(value)
+	}
+	fields.Version, _ = strconv.ParseUint(raw[versionAttribute], 10, 64)
+	if score.Err() == nil {
+		fields.Indexed = true
+		fields.IndexScore = time.Unix(0, int64(score.Val()))
+	}
+	return fields, true, nil
+}
+
+// IndexLen returns the number of entries in the cache's index, including
+// orphans.
+func (c *Cache) IndexLen(ctx context.Context) (int64, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.redisClient.ZCard(ctx, keys.index()).Result()
+}
+
+// Index returns the entries of the cache's index from start to stop, in the
+// order that their items will be evicted. Negative positions count from the
+// end, as with ZRANGE, so 0 and -1 return every entry.
+func (c *Cache) Index(ctx context.Context, start, stop int64) ([]IndexEntry, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.index(ctx, keys, start, stop)
+}
+
+func (c *Cache) index(ctx context.Context, keys keyspace, start, stop int64) ([]IndexEntry, error) {
+	members, err := c.redisClient.ZRangeWithScores(ctx, keys.index(), start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]IndexEntry, len(members))
+	for i, member := range members {
+		key, _ := member.Member.(string)
+		entries[i] = IndexEntry{Key: key, Score: time.Unix(0, int64(member.Score))}
+	}
+	return entries, nil
+}
+
+// Orphans returns the entries of the cache's index whose items no longer
+// exist, such as items that redis expired. Orphans count towards the maximum
+// size of the cache until they are evicted.
+func (c *Cache) Orphans(ctx context.Context) ([]IndexEntry, error) {
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []IndexEntry
+	for start := int64(0); ; start += scanCount {
+		entries, err := c.index(ctx, keys, start, start+scanCount-1)
+		if err != nil {
+			return nil, err
+		}
+
+		exists := make([]*redis.IntCmd, len(entries))
+		_, err = c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+			for i, entry := range entries {
+				exists[i] = pipeliner.Exists(ctx, entry.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i, entry := range entries {
+			if exists[i].Val() == 0 {
+				orphans = append(orphans, entry)
+			}
+		}
+
+		if len(entries) < scanCount {
+			return orphans, nil
+		}
+	}
+}
+
+// RemoveOrphans removes the entries of the cache's index whose items no
+// longer exist, returning the number of entries removed. Each entry is only
+// removed if its item still does not exist, so that items stored while the
+// orphans are removed keep their entries. This is atomic when the namespace
+// is a hash tag. Otherwise the index and the items can be on different nodes
+// of a cluster, and an item stored by another client between the check and
+// the removal can lose its entry.
+func (c *Cache) RemoveOrphans(ctx context.Context) (int, error) {
+	orphans, err := c.Orphans(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(writeLock)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, orphan := range orphans {
+		n, err := c.removeOrphan(ctx, keys, orphan.Key)
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// removeOrphan removes the index entry of an item if the item does not
+// exist, returning 1 if the entry was removed.
+func (c *Cache) removeOrphan(ctx context.Context, keys keyspace, key string) (int, error) {
+	if hasHashTag(c.namespace) {
+		return orphanScript.Run(ctx, c.redisClient, []string{keys.index(), key}, key).Int()
+	}
+
+	exists, err := c.redisClient.Exists(ctx, key).Result()
+	if err != nil || exists == 1 {
+		return 0, err
+	}
+	n, err := c.redisClient.ZRem(ctx, keys.index(), key).Result()
+	return int(n), err
+}
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-process redis used to test the cache without a redis
+// server. It fills in the parts of redis that miniredis does not implement
+// and that the cache uses.
+type fakeRedis struct {
+	*miniredis.Miniredis
+}
+
+func newFakeRedis() (*fakeRedis, error) {
+	m, err := miniredis.Run()
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRedis{m}, nil
+}
+
+// FastForward moves time forward, expiring keys, and publishes expired
+// keyspace events for the keys that expired.
+func (f *fakeRedis) FastForward(duration time.Duration) {
+	before := f.Keys()
+	f.Miniredis.FastForward(duration)
+
+	for _, key := range before {
+		if !f.Exists(key) {
+			f.Publish("__keyevent@0__:expired", key)
+		}
+	}
+}
+
+// fakeCluster is a set of fake redis nodes that each serve an equal range of
+// the cluster's hash slots. Like a redis cluster, the nodes redirect commands
+// for keys in slots that they do not serve and reject commands with keys in
+// more than one slot. Keys used by scripts without being passed as KEYS are
+// not checked.
+type fakeCluster []*fakeRedis
+
+// clusterSlots is the number of hash slots in a redis cluster.
+const clusterSlots = 16384
+
+func newFakeCluster(nodes int) (fakeCluster, error) {
+	cluster := make(fakeCluster, 0, nodes)
+	for i := 0; i < nodes; i++ {
+		node, err := newFakeRedis()
+		if err != nil {
+			cluster.Close()
+			return nil, err
+		}
+		cluster = append(cluster, node)
+	}
+	for i, node := range cluster {
+		node.Server().SetPreHook(cluster.slotHook(i))
+	}
+	return cluster, nil
+}
+
+// slotHook returns a hook for node i of the cluster that rejects commands
+// that are not for its slots.
+func (f fakeCluster) slotHook(i int) server.Hook {
+	return func(peer *server.Peer, cmd string, args ...string) bool {
+		keys := commandKeys(cmd, args)
+		if len(keys) == 0 {
+			return false
+		}
+
+		slot := keySlot(keys[0])
+		for _, key := range keys[1:] {
+			if keySlot(key) != slot {
+				peer.WriteError("CROSSSLOT Keys in request don't hash to the same slot")
+				return true
+			}
+		}
+		if start, end := f.slots(i); slot < start || slot > end {
+			owner := 0
+			for start, end := f.slots(owner); slot < start || slot > end; start, end = f.slots(owner) {
+				owner++
+			}
+			peer.WriteError(fmt.Sprintf("MOVED %d %s", slot, f[owner].Addr()))
+			return true
+		}
+		return false
+	}
+}
+
+// slots returns the first and last slot served by node i of the cluster.
+func (f fakeCluster) slots(i int) (int, int) {
+	return i * clusterSlots / len(f), (i+1)*clusterSlots/len(f) - 1
+}
+
+// keylessCommands are the commands used by the cache and its tests that do
+// not take keys.
+var keylessCommands = map[string]bool{
+	"AUTH": true, "CLIENT": true, "CLUSTER": true, "COMMAND": true,
+	"CONFIG": true, "DBSIZE": true, "DISCARD": true, "ECHO": true,
+	"EXEC": true, "FLUSHALL": true, "FLUSHDB": true, "HELLO": true,
+	"INFO": true, "KEYS": true, "MULTI": true, "PING": true,
+	"PSUBSCRIBE": true, "PUBLISH": true, "PUNSUBSCRIBE": true, "QUIT": true,
+	"READONLY": true, "READWRITE": true, "SCAN": true, "SCRIPT": true,
+	"SELECT": true, "SUBSCRIBE": true, "TIME": true, "UNSUBSCRIBE": true,
+}
+
+// commandKeys returns the keys that a command is for.
+func commandKeys(cmd string, args []string) []string {
+	switch cmd = strings.ToUpper(cmd); {
+	case keylessCommands[cmd] || len(args) == 0:
+		return nil
+	case cmd == "EVAL" || cmd == "EVALSHA" || cmd == "EVAL_RO" || cmd == "EVALSHA_RO":
+		numKeys, err := strconv.Atoi(args[1])
+		if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+			return nil
+		}
+		return args[2 : 2+numKeys]
+	case cmd == "DEL" || cmd == "EXISTS" || cmd == "UNLINK" || cmd == "TOUCH" || cmd == "MGET" || cmd == "WATCH":
+		return args
+	case cmd == "RENAME" || cmd == "RENAMENX":
+		return args[:2]
+	default:
+		return args[:1]
+	}
+}
+
+// keySlot returns the cluster hash slot of a key, which is the CRC16 of its
+// hash tag, or of the whole key if it does not have one.
+func keySlot(key string) int {
+	if open := strings.IndexByte(key, '{'); open >= 0 {
+		if end := strings.IndexByte(key[open+1:], '}'); end > 0 {
+			key = key[open+1 : open+1+end]
+		}
+	}
+
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % clusterSlots
+}
+
+// Client returns a cluster client that routes commands to the nodes of the
+// cluster. The slot layout is given to the client directly because the fake
+// nodes do not know about each other.
+func (f fakeCluster) Client() *redis.ClusterClient {
+	return redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(ctx context.Context) ([]redis.ClusterSlot, error) {
+			slots := make([]redis.ClusterSlot, len(f))
+			for i, node := range f {
+				start, end := f.slots(i)
+				slots[i] = redis.ClusterSlot{
+					Start: start,
+					End:   end,
+					Nodes: []redis.ClusterNode{{Addr: node.Addr()}},
+				}
+			}
+			return slots, nil
+		},
+	})
+}
+
+// Keys returns the keys stored on every node of the cluster.
+func (f fakeCluster) Keys() []string {
+	var keys []string
+	for _, node := range f {
+		keys = append(keys, node.Keys()...)
+	}
+	return keys
+}
+
+func (f fakeCluster) Close() {
+	for _, node := range f {
+		node.Close()
+	}
+}
@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanCount is the number of keys asked for with each SCAN when a count is
+// not given.
+const scanCount = 100
+
+// Len returns the number of items in the cache's namespace, including items
+// stored by other clients sharing the namespace. Only items of the current
+// generation are counted when generations are enabled. When the cache has a
+// maximum size, Len is the number of entries in the index, which includes
+// items that redis expired until they are evicted. Otherwise the namespace is
+// scanned, which takes time proportional to the number of keys.
+func (c *Cache) Len(ctx context.Context) (int, error) {
+	if c.namespace == "" {
+		return 0, ErrNoNamespace
+	}
+	if err := c.acquire(ctx, 1); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.maxSize > 0 {
+		count, err := c.redisClient.ZCard(ctx, keys.index()).Result()
+		return int(count), err
+	}
+
+	count := 0
+	err = c.scan(ctx, escapeGlob(keys.prefix)+"*", func(found []string) error {
+		for _, key := range found {
+			if c.isItemKey(keys, key) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Keys returns a page of the keys in the cache's namespace that start with
+// prefix. An empty cursor starts at the first page, and the returned cursor
+// is empty after the last page. The count is a hint for the size of the page,
+// and pages may be empty before the last page. Keys that were changed by a
+// custom KeyTransform are matched and returned as they were transformed.
+func (c *Cache) Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error) {
+	if c.namespace == "" {
+		return nil, "", ErrNoNamespace
+	}
+	if count <= 0 {
+		count = scanCount
+	}
+	if err := c.acquire(ctx, 1); err != nil {
+		return nil, "", err
+	}
+	defer c.lock.Release(1)
+
+	keys, err := c.keyspace(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	node, err := c.node(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var position uint64
+	if cursor != "" {
+		if position, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("yacache: invalid cursor %q", cursor)
+		}
+	}
+
+	found, next, err := node.Scan(ctx, position, escapeGlob(keys.prefix+prefix)+"*", int64(count)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	page := make([]string, 0, len(found))
+	for _, key := range found {
+		if c.isItemKey(keys, key) {
+			page = append(page, keys.untransform(key))
+		}
+	}
+
+	if next == 0 {
+		return page, "", nil
+	}
+	return page, strconv.FormatUint(next, 10), nil
+}
+
+// Clear deletes every item in the cache's namespace. It is the same as Flush.
+func (c *Cache) Clear(ctx context.Context) error {
+	return c.Flush(ctx)
+}
+
+// Flush deletes every item in the cache's namespace, including items stored
+// by other clients sharing the namespace and items of older generations. The
+// eviction callback is not called for flushed items.
+func (c *Cache) Flush(ctx context.Context) error {
+	if c.namespace == "" {
+		return ErrNoNamespace
+	}
+	if err := c.acquire(ctx, writeLock); err != nil {
+		return err
+	}
+	defer c.lock.Release(writeLock)
+
+	// The generation is kept so that items stored by clients that read it
+	// before the flush are not used again.
+	return c.scan(ctx, escapeGlob(c.namespace)+":*", func(found []string) error {
+		_, err := c.redisClient.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+			for _, key := range found {
+				if key != c.generationKey() {
+					pipeliner.Del(ctx, key)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// isItemKey returns true if a key found in the keyspace stores an item,
+// rather than being used to track items.
+func (c *Cache) isItemKey(keys keyspace, key string) bool {
+	return key != keys.index() && key != c.generationKey()
+}
+
+// scan calls fn with the keys that match the pattern, a page at a time.
+func (c *Cache) scan(ctx context.Context, match string, fn func(keys []string) error) error {
+	node, err := c.node(ctx)
+	if err != nil {
+		return err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err = fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// node returns a client for the redis server that holds the keys of the
+// cache's namespace. A namespace's keys are all on one node of a cluster or
+// ring because the namespace is a hash tag. The keys of a prefix given to
+// WithPrefix are spread across the nodes unless it contains a hash tag.
+func (c *Cache) node(ctx context.Context) (*redis.Client, error) {
+	if _, ok := c.redisClient.(*redis.Client); !ok && !hasHashTag(c.namespace) {
+		return nil, fmt.Errorf("yacache: the keys of prefix %q are on more than one node, use WithNamespace", c.namespace)
+	}
+
+	switch client := c.redisClient.(type) {
+	case *redis.Client:
+		return client, nil
+	case *redis.ClusterClient:
+		return client.MasterForKey(ctx, c.namespace)
+	case *redis.Ring:
+		return client.GetShardClientForKey(c.namespace)
+	default:
+		return nil, fmt.Errorf("yacache: cannot scan keys with a %T", client)
+	}
+}
+
+// escapeGlob escapes the characters that have a special meaning in the
+// patterns given to SCAN.
+func escapeGlob(value string) string {
+	var escaped strings.Builder
+	for _, r := range value {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
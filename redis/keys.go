@@ -1,7 +1,58 @@
 package redis
 
+import "strings"
+
 type KeyTransform func(string) string
 
 func DefaultKeyTransform(key string) string {
 	return key
 }
+
+// hashTag wraps a value in braces so that redis cluster uses only it to
+// choose the slot for keys that contain it. Values that already contain a
+// hash tag are returned as is.
+func hashTag(value string) string {
+	if hasHashTag(value) {
+		return value
+	}
+	return "{" + value + "}"
+}
+
+// hasHashTag returns true if a value contains a non-empty hash tag.
+func hasHashTag(value string) bool {
+	if open := strings.Index(value, "{"); open >= 0 {
+		if end := strings.Index(value[open+1:], "}"); end > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// keyspace builds the redis keys for a generation of a cache's namespace.
+type keyspace struct {
+	// prefix is added to every key, and is empty or ends with a colon.
+	prefix    string
+	transform KeyTransform
+}
+
+// item returns the redis key that an item is stored under.
+func (k keyspace) item(key string) string {
+	return k.prefix + k.transform(key)
+}
+
+// index returns the key of the sorted set that tracks the items.
+func (k keyspace) index() string {
+	return k.prefix + hitsMetaKey
+}
+
+// untransform returns the key that was given to the cache for a key stored
+// in redis. Keys changed by a custom KeyTransform are returned as they were
+// transformed.
+func (k keyspace) untransform(key string) string {
+	return strings.TrimPrefix(key, k.prefix)
+}
+
+// listed returns the redis key for a key returned by untransform.
+func (k keyspace) listed(key string) string {
+	return k.prefix + key
+}
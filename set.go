@@ -0,0 +1,15 @@
+package yacache
+
+import "context"
+
+// Set stores a cacheable into the cache, replacing any item already cached
+// for the key. Caches that do not implement Setter are given a fetcher that
+// returns the cacheable.
+func Set(ctx context.Context, cache Cache, key Key, cacheable Cacheable) error {
+	if setter, ok := cache.(Setter); ok {
+		return setter.Set(ctx, key, cacheable)
+	}
+	return cache.Put(ctx, key, func(ctx context.Context, key Key) (Cacheable, error) {
+		return cacheable, nil
+	})
+}
@@ -0,0 +1,63 @@
+package yacache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// putCache records the cacheable returned by the fetcher given to Put.
+type putCache struct {
+	failingCache
+	put Cacheable
+}
+
+func (c *putCache) Put(ctx context.Context, key Key, fetcher Fetcher) error {
+	cacheable, err := fetcher(ctx, key)
+	c.put = cacheable
+	return err
+}
+
+// setterCache records the cacheable given to Set.
+type setterCache struct {
+	failingCache
+	set Cacheable
+}
+
+func (c *setterCache) Set(ctx context.Context, key Key, cacheable Cacheable) error {
+	c.set = cacheable
+	return nil
+}
+
+type testCacheable struct{}
+
+func (testCacheable) Value() interface{} {
+	return "value"
+}
+
+func (testCacheable) Error() error {
+	return nil
+}
+
+func (testCacheable) Duration() time.Duration {
+	return time.Hour
+}
+
+func TestSet(t *testing.T) {
+	ctx := context.Background()
+	cacheable := testCacheable{}
+
+	setter := &setterCache{}
+	if err := Set(ctx, setter, nil, cacheable); err != nil || setter.set != cacheable {
+		t.Fatalf("expected the cacheable to be given to Set: %v", err)
+	}
+
+	put := &putCache{}
+	if err := Set(ctx, put, nil, cacheable); err != nil || put.put != cacheable {
+		t.Fatalf("expected the cacheable to be returned by the fetcher given to Put: %v", err)
+	}
+
+	if err := Set(ctx, failingCache{}, nil, cacheable); err == nil {
+		t.Fatal("expected the cache's error")
+	}
+}
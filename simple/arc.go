@@ -0,0 +1,145 @@
+package simple
+
+import "container/list"
+
+// ARCPolicy is an adaptive replacement cache policy. It balances between
+// keys that have been used once (t1) and keys that have been used more than
+// once (t2), remembering recently evicted keys (b1 and b2) to adapt the
+// balance to the workload.
+type ARCPolicy struct {
+	capacity int
+	target   int
+
+	t1 *list.List
+	t2 *list.List
+	b1 *list.List
+	b2 *list.List
+
+	entries map[string]*list.Element
+	lists   map[string]*list.List
+
+	inserted     string
+	insertedInB2 bool
+}
+
+// NewARCPolicy returns an adaptive replacement cache policy for a cache that
+// holds up to capacity keys.
+func NewARCPolicy(capacity int) Policy {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ARCPolicy{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		entries:  make(map[string]*list.Element),
+		lists:    make(map[string]*list.List),
+	}
+}
+
+func (p *ARCPolicy) OnAccess(key string) {
+	switch p.lists[key] {
+	case p.t1, p.t2:
+		p.move(key, p.t2)
+	}
+}
+
+func (p *ARCPolicy) OnInsert(key string) {
+	p.inserted = key
+	p.insertedInB2 = false
+
+	switch p.lists[key] {
+	case p.t1, p.t2:
+		p.move(key, p.t2)
+		return
+	case p.b1:
+		p.target += ratio(p.b2.Len(), p.b1.Len())
+		if p.target > p.capacity {
+			p.target = p.capacity
+		}
+		p.move(key, p.t2)
+	case p.b2:
+		p.target -= ratio(p.b1.Len(), p.b2.Len())
+		if p.target < 0 {
+			p.target = 0
+		}
+		p.insertedInB2 = true
+		p.move(key, p.t2)
+	default:
+		p.move(key, p.t1)
+	}
+
+	p.trim()
+}
+
+func (p *ARCPolicy) OnRemove(key string) {
+	switch p.lists[key] {
+	case p.t1, p.t2:
+		p.forget(key)
+	}
+}
+
+func (p *ARCPolicy) Victim() (string, bool) {
+	fromT1 := p.t1.Len() > 0 &&
+		(p.t1.Len() > p.target || (p.insertedInB2 && p.t1.Len() == p.target) || p.t2.Len() == 0)
+
+	// Avoid evicting the key that was just inserted when there is another
+	// choice.
+	if fromT1 && p.t1.Back().Value.(string) == p.inserted && p.t2.Len() > 0 && p.t1.Len() == 1 {
+		fromT1 = false
+	}
+	if !fromT1 && p.t2.Len() == 1 && p.t2.Back().Value.(string) == p.inserted && p.t1.Len() > 0 {
+		fromT1 = true
+	}
+
+	var key string
+	switch {
+	case fromT1:
+		key = p.t1.Back().Value.(string)
+		p.move(key, p.b1)
+	case p.t2.Len() > 0:
+		key = p.t2.Back().Value.(string)
+		p.move(key, p.b2)
+	default:
+		return "", false
+	}
+
+	p.trim()
+	return key, true
+}
+
+// move puts a key at the most recently used position of a list.
+func (p *ARCPolicy) move(key string, to *list.List) {
+	p.forget(key)
+	p.entries[key] = to.PushFront(key)
+	p.lists[key] = to
+}
+
+func (p *ARCPolicy) forget(key string) {
+	if l, ok := p.lists[key]; ok {
+		l.Remove(p.entries[key])
+		delete(p.entries, key)
+		delete(p.lists, key)
+	}
+}
+
+// trim drops the oldest remembered keys so that the history holds no more
+// than the capacity of the cache.
+func (p *ARCPolicy) trim() {
+	for p.t1.Len()+p.b1.Len() > p.capacity && p.b1.Len() > 0 {
+		p.forget(p.b1.Back().Value.(string))
+	}
+	for p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*p.capacity && p.b2.Len() > 0 {
+		p.forget(p.b2.Back().Value.(string))
+	}
+}
+
+// ratio returns a/b, but no less than 1.
+func ratio(a, b int) int {
+	if a <= b {
+		return 1
+	}
+	return a / b
+}
@@ -2,137 +2,400 @@ package simple
 
 import (
 	"context"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ngerakines/yacache"
+	"golang.org/x/sync/semaphore"
 )
 
 // Cache is an implementation of yacache.Cache that stores values in memory.
 type Cache struct {
-	keys   []string
+	policy Policy
 	values map[string]yacache.Item
+	costs  map[string]int64
 
-	maxSize          int
-	evictionCallback yacache.EvictionCallback
+	// tags holds the keys stored with each tag, and keyTags the tags of each
+	// key.
+	tags    map[string]map[string]struct{}
+	keyTags map[string][]string
 
-	mu sync.Mutex
+	// version is the version of the last item stored.
+	version uint64
+
+	maxSize             int
+	maxCost             int64
+	totalCost           int64
+	sizer               Sizer
+	evictionCallback    yacache.EvictionCallback
+	replacementCallback yacache.EvictionCallback
+	tinyLFU             bool
+	jitter              yacache.Jitter
+	sliding             bool
+	maxLifetime         time.Duration
+	clock               yacache.Clock
+	codec               Codec
+
+	// lock is held while the cache is read or changed, including while
+	// items are fetched. It is a semaphore so that waiting for it can be
+	// cancelled.
+	lock *semaphore.Weighted
+
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
 }
 
 // NewCache returns a configured simple cache implementation.
 func NewCache(options ...CacheOption) yacache.Cache {
 	cache := &Cache{
-		keys:             make([]string, 0),
 		values:           make(map[string]yacache.Item),
+		costs:            make(map[string]int64),
+		tags:             make(map[string]map[string]struct{}),
+		keyTags:          make(map[string][]string),
 		maxSize:          -1,
+		maxCost:          -1,
 		evictionCallback: nil,
+		clock:            yacache.SystemClock,
+		codec:            GobCodec{},
+		lock:             semaphore.NewWeighted(1),
 	}
 
 	for _, option := range options {
 		option(cache)
 	}
 
+	if cache.policy == nil && cache.tinyLFU {
+		cache.policy = NewTinyLFUPolicy(cache.maxSize)
+	} else if cache.policy == nil {
+		cache.policy = NewLRUPolicy()
+	}
+
 	return cache
 }
 
 func (c *Cache) Get(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) (yacache.Item, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.lock.Release(1)
 
 	kv := key.Value()
 
 	item, hasItem := c.values[kv]
-	if hasItem {
-		c.keys = remove(c.keys, kv)
-		c.keys = append(c.keys, kv)
+	if hasItem && item.Expired() {
+		c.remove(kv)
+		c.expirations.Add(1)
+	} else if hasItem {
+		c.policy.OnAccess(kv)
+		if simpleItem, ok := item.(Item); ok && c.sliding {
+			item = simpleItem.Slide(c.clock.Now(), c.maxLifetime)
+			c.values[kv] = item
+		}
+		c.hits.Add(1)
 		return item, nil
 	}
+	c.misses.Add(1)
 
 	cacheable, err := fetcher(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-
-	item = ItemFromCacheable(cacheable)
-	c.keys = append(c.keys, kv)
-	c.values[kv] = item
-
-	if c.maxSize > 0 && len(c.keys) > c.maxSize {
-		c.pop()
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
+	item, _ = c.store(kv, cacheable)
 	return item, nil
 }
 
 func (c *Cache) Put(ctx context.Context, key yacache.Key, fetcher yacache.Fetcher) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
 
 	kv := key.Value()
 
 	cacheable, err := fetcher(ctx, key)
 	if err != nil {
-		c.keys = remove(c.keys, kv)
-		c.keys = append(c.keys, kv)
+		if _, hasItem := c.values[kv]; hasItem {
+			c.policy.OnAccess(kv)
+		}
+		return err
+	}
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	item := ItemFromCacheable(cacheable)
-	c.keys = append(c.keys, kv)
-	c.values[kv] = item
+	c.store(kv, cacheable)
+
+	return nil
+}
+
+// Set stores a cacheable for a key, replacing any item already cached for the
+// key.
+func (c *Cache) Set(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
+
+	c.store(key.Value(), cacheable)
 
 	return nil
 }
 
 func (c *Cache) Contains(ctx context.Context, key yacache.Key) (bool, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(1)
 
-	_, hasItem := c.values[key.Value()]
+	item, hasItem := c.values[key.Value()]
 
-	return hasItem, nil
+	return hasItem && !item.Expired(), nil
 }
 
 func (c *Cache) Delete(ctx context.Context, key yacache.Key) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
+
+	c.remove(key.Value())
+
+	return nil
+}
+
+// Peek returns the item cached for a key without fetching it and without
+// changing when it will be evicted or when it expires.
+func (c *Cache) Peek(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.Release(1)
 
 	kv := key.Value()
-	c.keys = remove(c.keys, kv)
+	if _, hasItem := c.values[kv]; !hasItem || !c.live(kv) {
+		return nil, false, nil
+	}
+	return c.values[kv], true, nil
+}
+
+// PeekStale returns the item stored for a key, including an item that has
+// expired but has not been removed yet, without changing when it will be
+// evicted.
+func (c *Cache) PeekStale(ctx context.Context, key yacache.Key) (yacache.Item, bool, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, false, err
+	}
+	defer c.lock.Release(1)
+
+	item, hasItem := c.values[key.Value()]
+	return item, hasItem, nil
+}
+
+// Stats returns the cache's counters. Expirations are the expired items
+// removed when they were looked up by Get.
+func (c *Cache) Stats() yacache.Stats {
+	return yacache.Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
+// BumpGeneration invalidates every item in the cache by removing them, along
+// with the policy's record of them. It is the same as Clear, so the eviction
+// callback is not called for removed items and they are not counted as
+// evictions.
+func (c *Cache) BumpGeneration(ctx context.Context) error {
+	return c.Clear(ctx)
+}
+
+// acquire waits for the cache's lock, returning the context's error if it is
+// done before the lock is acquired.
+func (c *Cache) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.lock.Acquire(ctx, 1)
+}
+
+// store creates an item for a cacheable with the next version and inserts it.
+// It returns the item and whether it was kept in the cache.
+func (c *Cache) store(kv string, cacheable yacache.Cacheable) (yacache.Item, bool) {
+	c.version++
+	item := ItemFromCacheable(c.jitter.Cacheable(cacheable), WithItemClock(c.clock), WithItemVersion(c.version))
+	c.untag(kv)
+	kept := c.insert(kv, item, c.cost(cacheable))
+	if tagger, ok := cacheable.(yacache.Tagger); ok && kept {
+		c.tag(kv, tagger.Tags())
+	}
+	return item, kept
+}
+
+// InvalidateTag removes the items stored with a tag, returning the number of
+// items removed that had not expired. The eviction callback is not called
+// for removed items. Tags are not kept in snapshots.
+func (c *Cache) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	if err := c.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(1)
+
+	removed := 0
+	for kv := range c.tags[tag] {
+		if c.live(kv) {
+			removed++
+		}
+		c.remove(kv)
+	}
+	return removed, nil
+}
+
+// tag records the tags of a key.
+func (c *Cache) tag(kv string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	c.keyTags[kv] = tags
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+		c.tags[tag][kv] = struct{}{}
+	}
+}
+
+// untag forgets the tags of a key.
+func (c *Cache) untag(kv string) {
+	for _, tag := range c.keyTags[kv] {
+		delete(c.tags[tag], kv)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	delete(c.keyTags, kv)
+}
+
+// insert stores an item, replacing any existing item with the same key, and
+// then evicts items until the cache is within its size and cost limits. An
+// item that costs more than the maximum cost is not stored. An item that has
+// not expired is replaced in place, keeping the key's history in the policy.
+// It returns false if the item was not stored or was evicted to make room.
+func (c *Cache) insert(kv string, item yacache.Item, cost int64) bool {
+	replaced, hasItem := c.values[kv]
+	if hasItem && !c.live(kv) {
+		c.remove(kv)
+		hasItem = false
+	}
+
+	if !c.fits(cost) {
+		c.remove(kv)
+		return false
+	}
+
+	if hasItem {
+		c.totalCost -= c.costs[kv]
+	}
+	c.policy.OnInsert(kv)
+	c.values[kv] = item
+	c.costs[kv] = cost
+	c.totalCost += cost
+
+	if hasItem && c.replacementCallback != nil {
+		c.replacementCallback(Key(kv), replaced)
+	}
+
+	for c.maxSize > 0 && len(c.values) > c.maxSize {
+		if !c.pop() {
+			break
+		}
+	}
+	if policy, ok := c.policy.(*TinyLFUPolicy); ok && c.tinyLFU && c.maxSize <= 0 && c.maxCost > 0 && c.totalCost > c.maxCost {
+		// Without a maximum size, the policy is sized to the number of
+		// items that fit within the maximum cost.
+		policy.resize(len(c.values) - 1)
+	}
+	for c.maxCost > 0 && c.totalCost > c.maxCost && len(c.values) > 0 {
+		if !c.pop() {
+			break
+		}
+	}
+
+	_, kept := c.values[kv]
+	return kept
+}
+
+// fits returns true if an item with the cost can be stored within the
+// maximum cost.
+func (c *Cache) fits(cost int64) bool {
+	return c.maxCost <= 0 || cost <= c.maxCost
+}
+
+func (c *Cache) remove(kv string) {
+	if _, hasItem := c.values[kv]; hasItem {
+		c.policy.OnRemove(kv)
+	}
 	delete(c.values, kv)
+	c.totalCost -= c.costs[kv]
+	delete(c.costs, kv)
+	c.untag(kv)
+}
 
-	return nil
+// cost returns the cost of keeping a cacheable in the cache. The configured
+// sizer is used if there is one, then the cost reported by the cacheable if
+// it implements yacache.Coster, otherwise every cacheable costs 1.
+func (c *Cache) cost(cacheable yacache.Cacheable) int64 {
+	if c.sizer != nil {
+		return c.sizer(cacheable)
+	}
+	if coster, ok := cacheable.(yacache.Coster); ok {
+		return coster.Cost()
+	}
+	return 1
 }
 
-func (c *Cache) pop() {
-	var key string
-	key, c.keys = c.keys[0], c.keys[1:]
+// pop evicts the policy's victim. It returns false if nothing was evicted,
+// which happens when the policy does not return a key in the cache.
+func (c *Cache) pop() bool {
+	key, ok := c.policy.Victim()
+	if !ok {
+		return false
+	}
 
 	item, hasItem := c.values[key]
 	if !hasItem {
-		return
+		return false
 	}
 
 	delete(c.values, key)
+	c.totalCost -= c.costs[key]
+	delete(c.costs, key)
+	c.untag(key)
+	c.evictions.Add(1)
 	if c.evictionCallback != nil {
 		c.evictionCallback(Key(key), item)
 	}
+	return true
 }
 
-func remove(s []string, r string) []string {
-	for i, v := range s {
-		if v == r {
-			return append(s[:i], s[i+1:]...)
-		}
+// ItemFromCacheable populates an Item from a Cachable using the helpers
+// NewItem or NewErrorItem. The item is cached at the current time of the
+// item's clock.
+func ItemFromCacheable(item yacache.Cacheable, options ...ItemOption) yacache.Item {
+	var configured Item
+	for _, option := range options {
+		option(&configured)
 	}
-	return s
-}
+	now := configured.now()
 
-// ItemFromCacheable populates an Item from a Cachable using the helpers
-// NewItem or NewErrorItem.
-func ItemFromCacheable(item yacache.Cacheable) yacache.Item {
 	if err := item.Error(); err != nil {
-		return NewErrorItem(err, time.Now(), item.Duration())
+		return NewErrorItem(err, now, item.Duration(), options...)
 	}
-	return NewItem(item.Value(), time.Now(), item.Duration())
+	return NewItem(item.Value(), now, item.Duration(), options...)
 }
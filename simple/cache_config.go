@@ -1,9 +1,17 @@
 package simple
 
-import "github.com/ngerakines/yacache"
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
 
 type CacheOption func(cache *Cache) error
 
+// Sizer returns the cost of keeping a cacheable in the cache.
+type Sizer func(cacheable yacache.Cacheable) int64
+
 // WithMaxSize configures the maximum number of elements that the cache
 // will contain.
 func WithMaxSize(size int) func(cache *Cache) error {
@@ -13,6 +21,26 @@ func WithMaxSize(size int) func(cache *Cache) error {
 	}
 }
 
+// WithMaxCost configures the maximum total cost, such as a number of bytes,
+// of the elements that the cache will contain. The cost of an element is
+// determined by the sizer configured with WithSizer, or by the Cost method
+// of cacheables that implement yacache.Coster, and is 1 otherwise.
+func WithMaxCost(cost int64) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.maxCost = cost
+		return nil
+	}
+}
+
+// WithSizer configures the function used to determine the cost of elements
+// stored in the cache.
+func WithSizer(sizer Sizer) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.sizer = sizer
+		return nil
+	}
+}
+
 // WithEvictionHandler configures the eviction callback function for the
 // cache.
 func WithEvictionHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
@@ -21,3 +49,96 @@ func WithEvictionHandler(callback yacache.EvictionCallback) func(cache *Cache) e
 		return nil
 	}
 }
+
+// WithReplacementHandler configures a callback that is called with the item
+// that was replaced when an item is stored for a key that is already cached.
+func WithReplacementHandler(callback yacache.EvictionCallback) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.replacementCallback = callback
+		return nil
+	}
+}
+
+// WithPolicy configures the policy used to decide which elements to evict
+// when the cache is over its maximum size or cost. The default policy is LRU.
+// A policy must not be shared between caches.
+func WithPolicy(policy Policy) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.policy = policy
+		return nil
+	}
+}
+
+// WithTinyLFU configures the cache to use a W-TinyLFU admission and eviction
+// policy instead of LRU. Keys are only kept if they are estimated to be used
+// more frequently than the keys they would replace, which protects frequently
+// used keys from scans of keys that are used once. The policy is sized using
+// the maximum size configured with WithMaxSize. When only WithMaxCost is
+// configured, the policy is sized to the number of items that fit within the
+// maximum cost, which it learns as items are evicted.
+func WithTinyLFU() func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.tinyLFU = true
+		return nil
+	}
+}
+
+// WithJitter configures the cache to add or remove up to a fraction of the
+// duration of items when they are stored, for example 0.1 for up to 10%, so
+// that items cached at the same time do not all expire at the same time.
+func WithJitter(fraction float64) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.Fraction = fraction
+		return nil
+	}
+}
+
+// WithJitterDuration configures the cache to add or remove up to max from the
+// duration of items when they are stored. When used with WithJitter, it caps
+// the jitter applied to long durations.
+func WithJitterDuration(max time.Duration) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.Max = max
+		return nil
+	}
+}
+
+// WithJitterSource configures the source of randomness used to apply jitter,
+// which makes it deterministic for a seeded source.
+func WithJitterSource(source rand.Source) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.jitter.SetSource(source)
+		return nil
+	}
+}
+
+// WithSlidingExpiration configures the cache to reset the expiration of items
+// each time they are returned by Get, so that items stay cached for as long
+// as they continue to be used. The Cached time of an item is the time that it
+// was last refreshed. Items expire no later than maxLifetime after they were
+// first cached, unless maxLifetime is 0.
+func WithSlidingExpiration(maxLifetime time.Duration) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.sliding = true
+		cache.maxLifetime = maxLifetime
+		return nil
+	}
+}
+
+// WithClock configures the clock used to record when items are cached and to
+// decide if they have expired.
+func WithClock(clock yacache.Clock) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.clock = clock
+		return nil
+	}
+}
+
+// WithCodec configures the codec used to encode the values of items in
+// snapshots. The default codec is GobCodec.
+func WithCodec(codec Codec) func(cache *Cache) error {
+	return func(cache *Cache) error {
+		cache.codec = codec
+		return nil
+	}
+}
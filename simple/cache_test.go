@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/ngerakines/yacache/cachetest"
+	"math/rand"
 	"strconv"
 	"testing"
 	"time"
@@ -11,7 +12,7 @@ import (
 	"github.com/ngerakines/yacache"
 )
 
-func ExampleNewCache_Get() {
+func ExampleNewCache_get() {
 	ctx := context.Background()
 	c := NewCache()
 	key := Key("foo")
@@ -24,7 +25,7 @@ func ExampleNewCache_Get() {
 	// Output: bar
 }
 
-func ExampleNewCache_Put() {
+func ExampleNewCache_put() {
 	ctx := context.Background()
 	c := NewCache()
 	key := Key("foo")
@@ -45,6 +46,17 @@ func TestCache(t *testing.T) {
 	cachetest.Standard(t, c, key, key2, fetcher)
 }
 
+func TestCacheSuite(t *testing.T) {
+	cachetest.RunSuite(t, func(t *testing.T, config cachetest.Config) yacache.Cache {
+		return NewCache(
+			WithMaxSize(config.MaxSize),
+			WithEvictionHandler(config.EvictionCallback),
+			WithReplacementHandler(config.ReplacementCallback),
+			WithClock(config.Clock),
+		)
+	})
+}
+
 func TestCacheMaxSize(t *testing.T) {
 	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
 		return NewCacheableValue("value", 1*time.Hour), nil
@@ -73,6 +85,433 @@ func TestCacheMaxSize(t *testing.T) {
 	}
 }
 
+type sizedValue []byte
+
+func (v sizedValue) Value() interface{} {
+	return []byte(v)
+}
+
+func (v sizedValue) Error() error {
+	return nil
+}
+
+func (v sizedValue) Duration() time.Duration {
+	return 1 * time.Hour
+}
+
+func (v sizedValue) Cost() int64 {
+	return int64(len(v))
+}
+
+func TestCacheMaxCost(t *testing.T) {
+	ctx := context.Background()
+
+	sizes := map[string]int{
+		"tiny":   40,
+		"small":  1000,
+		"medium": 4000,
+		"large":  9000,
+		"huge":   20000,
+	}
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return sizedValue(make([]byte, sizes[fkey.Value()])), nil
+	}
+
+	evictions := []string{}
+	evictionCB := func(key yacache.Key, item yacache.Item) {
+		evictions = append(evictions, key.Value())
+	}
+
+	c := NewCache(
+		WithMaxCost(10000),
+		WithEvictionHandler(evictionCB),
+	)
+
+	for _, k := range []string{"tiny", "small", "medium"} {
+		if _, err := c.Get(ctx, Key(k), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(evictions) != 0 {
+		t.Fatalf("expected no evictions but got %v", evictions)
+	}
+
+	// Touch tiny so that small and medium are the least recently used.
+	if _, err := c.Get(ctx, Key("tiny"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(ctx, Key("large"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(evictions) != "[small medium]" {
+		t.Fatalf("unexpected evictions: %v", evictions)
+	}
+	for k, expected := range map[string]bool{"tiny": true, "small": false, "medium": false, "large": true} {
+		if ok := yacache.EnsureCacheContains(c, ctx, Key(k)); ok != expected {
+			t.Fatalf("expected contains %s to be %t", k, expected)
+		}
+	}
+
+	// An item that can never fit is returned but not cached.
+	item, err := c.Get(ctx, Key("huge"), fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(item.Value().([]byte)) != 20000 {
+		t.Fatal("unexpected value for huge")
+	}
+	if yacache.EnsureCacheContains(c, ctx, Key("huge")) {
+		t.Fatal("huge should not be in the cache")
+	}
+	if fmt.Sprint(evictions) != "[small medium]" {
+		t.Fatalf("unexpected evictions: %v", evictions)
+	}
+}
+
+func TestCacheMaxCost_sizer(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		n, _ := strconv.Atoi(fkey.Value())
+		return NewCacheableValue(make([]byte, n), 1*time.Hour), nil
+	}
+
+	c := NewCache(
+		WithMaxCost(1024),
+		WithSizer(func(cacheable yacache.Cacheable) int64 {
+			return int64(len(cacheable.Value().([]byte)))
+		}),
+	)
+
+	for _, n := range []int{100, 900, 24, 512, 40, 400} {
+		if _, err := c.Get(ctx, Key(strconv.Itoa(n)), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 100 and 900 are evicted to make room for 512, leaving 24, 512, 40 and
+	// 400 (976 bytes).
+	for n, expected := range map[int]bool{100: false, 900: false, 24: true, 512: true, 40: true, 400: true} {
+		if ok := yacache.EnsureCacheContains(c, ctx, Key(strconv.Itoa(n))); ok != expected {
+			t.Fatalf("expected contains %d to be %t", n, expected)
+		}
+	}
+
+	// Overwriting an item replaces its cost rather than adding to it.
+	for i := 0; i < 3; i++ {
+		yacache.EnsureCachePut(c, ctx, Key("400"), fetcher)
+	}
+	if !yacache.EnsureCacheContains(c, ctx, Key("512")) {
+		t.Fatal("expected 512 to remain in the cache")
+	}
+}
+
+func TestCacheMaxCost_conditional(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(
+		WithMaxCost(10),
+		WithSizer(func(cacheable yacache.Cacheable) int64 {
+			return int64(len(cacheable.Value().(string)))
+		}),
+	).(*Cache)
+	large := NewCacheableValue("more than ten", time.Hour)
+
+	if stored, err := c.SetIfAbsent(ctx, Key("a"), large); err != nil || stored {
+		t.Fatalf("expected SetIfAbsent not to store an item that costs too much: %v, %v", stored, err)
+	}
+	if yacache.EnsureCacheContains(c, ctx, Key("a")) {
+		t.Fatal("expected the item not to be stored")
+	}
+
+	if stored, err := c.SetIfAbsent(ctx, Key("b"), NewCacheableValue("small", time.Hour)); err != nil || !stored {
+		t.Fatalf("expected SetIfAbsent to store the item: %v, %v", stored, err)
+	}
+	item, _, err := c.Peek(ctx, Key("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := c.SetIfVersion(ctx, Key("b"), large, item.(yacache.Versioned).Version()); err != nil || stored {
+		t.Fatalf("expected SetIfVersion not to store an item that costs too much: %v, %v", stored, err)
+	}
+	if item, ok, err := c.Peek(ctx, Key("b")); err != nil || !ok || item.Value() != "small" {
+		t.Fatalf("expected the current item to be kept but got %v: %v", item, err)
+	}
+}
+
+func TestCacheInvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache(WithMaxSize(3)).(*Cache)
+
+	yacache.EnsureCacheSet(c, ctx, Key("a"), NewTaggedCacheable(NewCacheableValue("a", time.Hour), "users", "admins"))
+	yacache.EnsureCacheSet(c, ctx, Key("b"), NewTaggedCacheable(NewCacheableValue("b", time.Hour), "users"))
+	yacache.EnsureCacheSet(c, ctx, Key("c"), NewCacheableValue("c", time.Hour))
+
+	// Replacing an item replaces its tags.
+	yacache.EnsureCacheSet(c, ctx, Key("b"), NewCacheableValue("b", time.Hour))
+
+	if removed, err := c.InvalidateTag(ctx, "users"); err != nil || removed != 1 {
+		t.Fatalf("expected 1 item to be removed but got %d: %v", removed, err)
+	}
+	for key, expected := range map[string]bool{"a": false, "b": true, "c": true} {
+		if ok := yacache.EnsureCacheContains(c, ctx, Key(key)); ok != expected {
+			t.Fatalf("expected contains %s to be %t", key, expected)
+		}
+	}
+	if len(c.tags) != 0 || len(c.keyTags) != 0 {
+		t.Fatalf("expected the tags of removed items to be forgotten: %v %v", c.tags, c.keyTags)
+	}
+}
+
+func TestCacheJitter(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	durations := func() []time.Duration {
+		c := NewCache(
+			WithJitter(0.1),
+			WithJitterSource(rand.NewSource(1)),
+		)
+		var durations []time.Duration
+		for i := 0; i < 10; i++ {
+			item := yacache.EnsureCacheGet(c, ctx, Key(strconv.Itoa(i)), fetcher)
+			if item.Duration() < 54*time.Minute || item.Duration() > 66*time.Minute {
+				t.Fatalf("duration %s is outside of the jitter bound", item.Duration())
+			}
+			durations = append(durations, item.Duration())
+		}
+		return durations
+	}
+
+	first, second := durations(), durations()
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatalf("expected the same durations for the same source: %v %v", first, second)
+	}
+	if first[0] == first[1] && first[1] == first[2] {
+		t.Fatalf("expected durations to vary: %v", first)
+	}
+}
+
+func TestCacheSlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	fetches := 0
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		fetches++
+		return NewCacheableValue("value", 50*time.Second), nil
+	}
+
+	c := NewCache(
+		WithSlidingExpiration(200*time.Second),
+		WithClock(clock),
+	)
+
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	for i := 0; i < 4; i++ {
+		clock.Advance(30 * time.Second)
+		item := yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+		if !item.Cached().Equal(clock.Now()) {
+			t.Fatal("expected the cached time to be refreshed")
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 fetch but got %d", fetches)
+	}
+
+	// Reading the item keeps it alive until it reaches its max lifetime.
+	clock.Advance(30 * time.Second)
+	item := yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	if item.Duration() != 50*time.Second {
+		t.Fatalf("expected a duration of 50s but got %s", item.Duration())
+	}
+	clock.Advance(30 * time.Second)
+	item = yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	if item.Duration() != 20*time.Second {
+		t.Fatalf("expected the duration to be limited to 20s but got %s", item.Duration())
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 fetch but got %d", fetches)
+	}
+
+	clock.Advance(21 * time.Second)
+	if yacache.EnsureCacheContains(c, ctx, Key("foo")) {
+		t.Fatal("expected the item to have expired")
+	}
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	if fetches != 2 {
+		t.Fatalf("expected 2 fetches but got %d", fetches)
+	}
+}
+
+func TestCacheExpiration(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	fetches := 0
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		fetches++
+		return NewCacheableValue("value", 50*time.Second), nil
+	}
+
+	c := NewCache(WithClock(clock))
+
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	clock.Advance(30 * time.Second)
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	clock.Advance(30 * time.Second)
+	if yacache.EnsureCacheContains(c, ctx, Key("foo")) {
+		t.Fatal("expected the item to have expired")
+	}
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	if fetches != 2 {
+		t.Fatalf("expected 2 fetches but got %d", fetches)
+	}
+}
+
+func TestCacheBumpGeneration(t *testing.T) {
+	ctx := context.Background()
+
+	fetches := 0
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		fetches++
+		return NewCacheableValue(fetches, 1*time.Hour), nil
+	}
+
+	evictions := []string{}
+	evictionCB := func(key yacache.Key, item yacache.Item) {
+		evictions = append(evictions, key.Value())
+	}
+
+	c := NewCache(WithMaxSize(2), WithEvictionHandler(evictionCB))
+
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	yacache.EnsureCacheGet(c, ctx, Key("bar"), fetcher)
+
+	if err := c.(*Cache).BumpGeneration(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.(*Cache).values) != 0 || len(c.(*Cache).policy.(*LRUPolicy).entries) != 0 {
+		t.Fatal("expected the items of the old generation to be removed")
+	}
+
+	if yacache.EnsureCacheContains(c, ctx, Key("foo")) {
+		t.Fatal("expected the item to be invalidated")
+	}
+	item := yacache.EnsureCacheGet(c, ctx, Key("bar"), fetcher)
+	if item.Value() != 3 {
+		t.Fatalf("expected the item to be fetched again, got %v", item.Value())
+	}
+	yacache.EnsureCacheGet(c, ctx, Key("baz"), fetcher)
+	if !yacache.EnsureCacheContains(c, ctx, Key("bar")) {
+		t.Fatal("expected the item from the current generation to be kept")
+	}
+	if len(evictions) != 0 || c.(*Cache).Stats().Evictions != 0 {
+		t.Fatalf("expected invalidated items not to be evicted but got %v", evictions)
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		if fkey.Value() == "short" {
+			return NewCacheableValue("value", 1*time.Second), nil
+		}
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	c := NewCache(WithClock(clock), WithMaxSize(3)).(*Cache)
+	for _, key := range []string{"b", "short", "a", "c"} {
+		yacache.EnsureCacheGet(c, ctx, Key(key), fetcher)
+	}
+	clock.Advance(time.Minute)
+
+	var pages [][]string
+	cursor := ""
+	for {
+		keys, next, err := c.Keys(ctx, cursor, "", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, keys)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if fmt.Sprint(pages) != "[[a c]]" {
+		t.Fatalf("unexpected pages of keys: %v", pages)
+	}
+
+	// Listing keys does not change the eviction order.
+	yacache.EnsureCacheGet(c, ctx, Key("d"), fetcher)
+	yacache.EnsureCacheGet(c, ctx, Key("e"), fetcher)
+	if yacache.EnsureCacheContains(c, ctx, Key("a")) {
+		t.Fatal("expected the least recently used item to be evicted")
+	}
+
+	if _, _, err := c.Keys(ctx, "nope", "", 0); err == nil {
+		t.Fatal("expected an invalid cursor to be an error")
+	}
+}
+
+func TestCachePeek(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", 1*time.Minute), nil
+	}
+
+	c := NewCache(WithMaxSize(2), WithClock(clock), WithSlidingExpiration(0)).(*Cache)
+	yacache.EnsureCacheGet(c, ctx, Key("foo"), fetcher)
+	yacache.EnsureCacheGet(c, ctx, Key("bar"), fetcher)
+
+	clock.Advance(30 * time.Second)
+	item, ok, err := c.Peek(ctx, Key("foo"))
+	if err != nil || !ok {
+		t.Fatalf("expected the item, got %v: %v", ok, err)
+	}
+	if !item.Cached().Equal(clock.Now().Add(-30 * time.Second)) {
+		t.Fatal("expected peeking not to slide the expiration")
+	}
+
+	// Peeking does not make foo more recently used than bar.
+	yacache.EnsureCacheGet(c, ctx, Key("baz"), fetcher)
+	if yacache.EnsureCacheContains(c, ctx, Key("foo")) {
+		t.Fatal("expected the least recently used item to be evicted")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+	c := NewCache(WithMaxSize(2), WithClock(clock)).(*Cache)
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", time.Minute), nil
+	}
+
+	for _, key := range []string{"a", "a", "b", "c"} {
+		if _, err := c.Get(ctx, Key(key), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := c.Get(ctx, Key("c"), fetcher); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := yacache.Stats{Hits: 1, Misses: 4, Evictions: 1, Expirations: 1}
+	if stats := c.Stats(); stats != expected {
+		t.Fatalf("expected %+v but got %+v", expected, stats)
+	}
+}
+
 func BenchmarkCacheGet(b *testing.B) {
 	ctx := context.Background()
 
@@ -0,0 +1,76 @@
+package simple
+
+import (
+	"context"
+
+	"github.com/ngerakines/yacache"
+)
+
+// SetIfAbsent stores a cacheable if no item that has not expired is cached
+// for the key. It returns true if the cacheable was stored. A cacheable that
+// costs more than the maximum cost is not stored.
+func (c *Cache) SetIfAbsent(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable) (bool, error) {
+	if err := c.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(1)
+
+	kv := key.Value()
+	if _, hasItem := c.values[kv]; hasItem && c.live(kv) {
+		return false, nil
+	}
+	if !c.fits(c.cost(cacheable)) {
+		return false, nil
+	}
+
+	_, stored := c.store(kv, cacheable)
+	return stored, nil
+}
+
+// SetIfVersion stores a cacheable if the item cached for the key has not
+// expired and has the version. It returns true if the cacheable was stored. A
+// cacheable that costs more than the maximum cost is not stored, and the
+// current item is kept.
+func (c *Cache) SetIfVersion(ctx context.Context, key yacache.Key, cacheable yacache.Cacheable, version uint64) (bool, error) {
+	if err := c.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(1)
+
+	kv := key.Value()
+	if !c.hasVersion(kv, version) || !c.fits(c.cost(cacheable)) {
+		return false, nil
+	}
+
+	_, stored := c.store(kv, cacheable)
+	return stored, nil
+}
+
+// DeleteIfVersion removes the item cached for the key if it has not expired
+// and has the version. It returns true if the item was removed.
+func (c *Cache) DeleteIfVersion(ctx context.Context, key yacache.Key, version uint64) (bool, error) {
+	if err := c.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer c.lock.Release(1)
+
+	kv := key.Value()
+	if !c.hasVersion(kv, version) {
+		return false, nil
+	}
+
+	c.remove(kv)
+
+	return true, nil
+}
+
+// hasVersion returns true if the item cached for a key is live and has the
+// version.
+func (c *Cache) hasVersion(kv string, version uint64) bool {
+	item, hasItem := c.values[kv]
+	if !hasItem || !c.live(kv) {
+		return false
+	}
+	versioned, ok := item.(yacache.Versioned)
+	return ok && versioned.Version() == version
+}
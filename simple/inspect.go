@@ -0,0 +1,82 @@
+package simple
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keysCount is the number of keys returned by Keys when a count is not given.
+const keysCount = 100
+
+// Len returns the number of items in the cache that have not expired.
+func (c *Cache) Len(ctx context.Context) (int, error) {
+	if err := c.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer c.lock.Release(1)
+
+	count := 0
+	for kv := range c.values {
+		if c.live(kv) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Keys returns a page of the keys of items in the cache that start with
+// prefix and have not expired, in sorted order. An empty cursor starts at the
+// first page, and the returned cursor is empty after the last page. Listing
+// keys does not change the order items are evicted in.
+func (c *Cache) Keys(ctx context.Context, cursor string, prefix string, count int) ([]string, string, error) {
+	after := ""
+	if cursor != "" {
+		if !strings.HasPrefix(cursor, ">") {
+			return nil, "", fmt.Errorf("yacache: invalid cursor %q", cursor)
+		}
+		after = cursor[1:]
+	}
+	if count <= 0 {
+		count = keysCount
+	}
+
+	if err := c.acquire(ctx); err != nil {
+		return nil, "", err
+	}
+	defer c.lock.Release(1)
+
+	var keys []string
+	for kv := range c.values {
+		if strings.HasPrefix(kv, prefix) && (cursor == "" || kv > after) && c.live(kv) {
+			keys = append(keys, kv)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) <= count {
+		return keys, "", nil
+	}
+	keys = keys[:count]
+	return keys, ">" + keys[count-1], nil
+}
+
+// Clear removes every item from the cache. The eviction callback is not
+// called for removed items.
+func (c *Cache) Clear(ctx context.Context) error {
+	if err := c.acquire(ctx); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
+
+	for kv := range c.values {
+		c.remove(kv)
+	}
+	return nil
+}
+
+// live returns true if the item stored for a key has not expired.
+func (c *Cache) live(kv string) bool {
+	return !c.values[kv].Expired()
+}
@@ -0,0 +1,28 @@
+package simple
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/ngerakines/yacache"
+)
+
+// ReadKeys reads keys from r, one per line, such as a list of hot keys to
+// give to yacache.Warm. Surrounding whitespace is trimmed, and blank lines and
+// lines starting with "#" are skipped.
+func ReadKeys(r io.Reader) ([]yacache.Key, error) {
+	var keys []yacache.Key
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, Key(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,21 @@
+package simple
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadKeys(t *testing.T) {
+	keys, err := ReadKeys(strings.NewReader("# hot keys\nfoo\n\n  bar  \nbaz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []string
+	for _, key := range keys {
+		values = append(values, key.Value())
+	}
+	if strings.Join(values, ",") != "foo,bar,baz" {
+		t.Fatalf("unexpected keys: %v", values)
+	}
+}
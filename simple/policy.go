@@ -0,0 +1,252 @@
+package simple
+
+import (
+	"container/list"
+	"sort"
+)
+
+// Policy decides which key should be evicted from the cache when it is over
+// its limits. A policy is used by a single cache and is only called while the
+// cache holds its lock, so implementations do not need to be safe for
+// concurrent use.
+type Policy interface {
+	// OnAccess records that a key in the cache was read.
+	OnAccess(key string)
+
+	// OnInsert records that a key was added to the cache. It is also called
+	// when the item for a key already in the cache is replaced, in which case
+	// the history of the key is kept.
+	OnInsert(key string)
+
+	// OnRemove records that a key was removed from the cache.
+	OnRemove(key string)
+
+	// Victim selects a key to evict, which is no longer in the cache once it
+	// is returned. Policies may remember evicted keys, as ARC and 2Q do, to
+	// inform later decisions. False is returned if there are no keys in the
+	// cache to evict. The cache stops evicting, and may be left over its
+	// limits, when Victim returns false or a key that is not in the cache.
+	Victim() (string, bool)
+}
+
+// OrderedPolicy is implemented by policies that can list the keys they track
+// in the order they would be evicted. Inserting the keys into a new policy in
+// that order gives the same eviction order.
+type OrderedPolicy interface {
+	Policy
+
+	// Keys returns the tracked keys, starting with the next to be evicted.
+	Keys() []string
+}
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy struct {
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// FIFOPolicy evicts the key that was inserted first, regardless of how it
+// has been used since.
+type FIFOPolicy struct {
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// LFUPolicy evicts the least frequently used key. Ties are broken by evicting
+// the least recently used of the least frequently used keys.
+type LFUPolicy struct {
+	entries map[string]*list.Element
+	freqs   map[int]*list.List
+	minFreq int
+}
+
+type lfuEntry struct {
+	key  string
+	freq int
+}
+
+// NewLRUPolicy returns a least recently used eviction policy. It is the
+// default policy of the cache.
+func NewLRUPolicy() Policy {
+	return &LRUPolicy{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// NewFIFOPolicy returns a first in, first out eviction policy.
+func NewFIFOPolicy() Policy {
+	return &FIFOPolicy{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// NewLFUPolicy returns a least frequently used eviction policy.
+func NewLFUPolicy() Policy {
+	return &LFUPolicy{
+		entries: make(map[string]*list.Element),
+		freqs:   make(map[int]*list.List),
+	}
+}
+
+func (p *LRUPolicy) OnAccess(key string) {
+	if e, ok := p.entries[key]; ok {
+		p.order.MoveToBack(e)
+	}
+}
+
+func (p *LRUPolicy) OnInsert(key string) {
+	if e, ok := p.entries[key]; ok {
+		p.order.MoveToBack(e)
+		return
+	}
+	p.entries[key] = p.order.PushBack(key)
+}
+
+func (p *LRUPolicy) OnRemove(key string) {
+	if e, ok := p.entries[key]; ok {
+		p.order.Remove(e)
+		delete(p.entries, key)
+	}
+}
+
+func (p *LRUPolicy) Victim() (string, bool) {
+	e := p.order.Front()
+	if e == nil {
+		return "", false
+	}
+	key := p.order.Remove(e).(string)
+	delete(p.entries, key)
+	return key, true
+}
+
+func (p *LRUPolicy) Keys() []string {
+	return listKeys(p.order)
+}
+
+func (p *FIFOPolicy) OnAccess(key string) {
+}
+
+func (p *FIFOPolicy) OnInsert(key string) {
+	if _, ok := p.entries[key]; ok {
+		return
+	}
+	p.entries[key] = p.order.PushBack(key)
+}
+
+func (p *FIFOPolicy) OnRemove(key string) {
+	if e, ok := p.entries[key]; ok {
+		p.order.Remove(e)
+		delete(p.entries, key)
+	}
+}
+
+func (p *FIFOPolicy) Victim() (string, bool) {
+	e := p.order.Front()
+	if e == nil {
+		return "", false
+	}
+	key := p.order.Remove(e).(string)
+	delete(p.entries, key)
+	return key, true
+}
+
+func (p *FIFOPolicy) Keys() []string {
+	return listKeys(p.order)
+}
+
+func (p *LFUPolicy) OnAccess(key string) {
+	e, ok := p.entries[key]
+	if !ok {
+		return
+	}
+
+	entry := p.unlink(e)
+	entry.freq++
+	p.link(entry)
+}
+
+func (p *LFUPolicy) OnInsert(key string) {
+	if _, ok := p.entries[key]; ok {
+		p.OnAccess(key)
+		return
+	}
+	p.link(&lfuEntry{key: key, freq: 1})
+	p.minFreq = 1
+}
+
+func (p *LFUPolicy) OnRemove(key string) {
+	if e, ok := p.entries[key]; ok {
+		p.unlink(e)
+		delete(p.entries, key)
+	}
+}
+
+func (p *LFUPolicy) Victim() (string, bool) {
+	if len(p.entries) == 0 {
+		return "", false
+	}
+
+	if _, ok := p.freqs[p.minFreq]; !ok {
+		p.minFreq = -1
+		for freq := range p.freqs {
+			if p.minFreq == -1 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+	}
+
+	entry := p.unlink(p.freqs[p.minFreq].Front())
+	delete(p.entries, entry.key)
+	return entry.key, true
+}
+
+// Keys returns the keys from the least to the most frequently used. The
+// frequencies are not kept when the keys are inserted into a new policy.
+func (p *LFUPolicy) Keys() []string {
+	freqs := make([]int, 0, len(p.freqs))
+	for freq := range p.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Ints(freqs)
+
+	keys := make([]string, 0, len(p.entries))
+	for _, freq := range freqs {
+		for e := p.freqs[freq].Front(); e != nil; e = e.Next() {
+			keys = append(keys, e.Value.(*lfuEntry).key)
+		}
+	}
+	return keys
+}
+
+func (p *LFUPolicy) link(entry *lfuEntry) {
+	l, ok := p.freqs[entry.freq]
+	if !ok {
+		l = list.New()
+		p.freqs[entry.freq] = l
+	}
+	p.entries[entry.key] = l.PushBack(entry)
+}
+
+func (p *LFUPolicy) unlink(e *list.Element) *lfuEntry {
+	entry := e.Value.(*lfuEntry)
+	l := p.freqs[entry.freq]
+	l.Remove(e)
+	if l.Len() == 0 {
+		delete(p.freqs, entry.freq)
+		if p.minFreq == entry.freq {
+			p.minFreq++
+		}
+	}
+	return entry
+}
+
+// listKeys returns the keys in a list of keys, from front to back.
+func listKeys(l *list.List) []string {
+	keys := make([]string, 0, l.Len())
+	for e := l.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
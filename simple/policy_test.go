@@ -0,0 +1,188 @@
+package simple
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/cachetest"
+)
+
+func TestCacheMaxSize_policies(t *testing.T) {
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	policies := map[string]func() Policy{
+		"lru":     NewLRUPolicy,
+		"fifo":    NewFIFOPolicy,
+		"lfu":     NewLFUPolicy,
+		"arc":     func() Policy { return NewARCPolicy(5) },
+		"2q":      func() Policy { return New2QPolicy(5) },
+		"tinylfu": func() Policy { return NewTinyLFUPolicy(5) },
+	}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			c := NewCache(
+				WithMaxSize(5),
+				WithPolicy(policy()),
+			)
+
+			cachetest.MaxSize(t, c, fetcher, func(s string) yacache.Key {
+				return Key(s)
+			})
+		})
+	}
+}
+
+func TestCacheEvictionOrder_policies(t *testing.T) {
+	trace := []string{"a", "b", "c", "a", "d", "a", "e", "b", "f"}
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		evictions string
+	}{
+		{"lru", NewLRUPolicy(), "[b c d a]"},
+		{"fifo", NewFIFOPolicy(), "[a b c d a]"},
+		{"lfu", NewLFUPolicy(), "[b c d e]"},
+		{"arc", NewARCPolicy(3), "[b c d e]"},
+		{"2q", New2QPolicy(3), "[a b c d e]"},
+		{"tinylfu", NewTinyLFUPolicy(3), "[c d e]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+				return NewCacheableValue("value", 1*time.Hour), nil
+			}
+
+			evictions := []string{}
+			evictionCB := func(key yacache.Key, item yacache.Item) {
+				evictions = append(evictions, key.Value())
+			}
+
+			c := NewCache(
+				WithMaxSize(3),
+				WithPolicy(tt.policy),
+				WithEvictionHandler(evictionCB),
+			)
+
+			for _, k := range trace {
+				yacache.EnsureCacheGet(c, ctx, Key(k), fetcher)
+			}
+			if fmt.Sprint(evictions) != tt.evictions {
+				t.Fatalf("expected evictions %s but got %v", tt.evictions, evictions)
+			}
+		})
+	}
+}
+
+func TestARCPolicy_adapts(t *testing.T) {
+	p := NewARCPolicy(2).(*ARCPolicy)
+
+	p.OnInsert("a")
+	p.OnInsert("b")
+	p.OnAccess("a")
+	p.OnInsert("c")
+	if key, _ := p.Victim(); key != "b" {
+		t.Fatalf("expected b to be evicted but got %s", key)
+	}
+
+	// b is remembered after being evicted from t1, so inserting it again
+	// grows the target size of t1 and puts b in t2.
+	p.OnInsert("b")
+	if p.target != 1 {
+		t.Fatalf("expected target to be 1 but got %d", p.target)
+	}
+	if p.lists["b"] != p.t2 {
+		t.Fatal("expected b to be in t2")
+	}
+
+	// t1 is at its target, so the victim comes from t2.
+	if key, _ := p.Victim(); key != "a" {
+		t.Fatalf("expected a to be evicted but got %s", key)
+	}
+	if p.lists["a"] != p.b2 {
+		t.Fatal("expected a to be remembered in b2")
+	}
+}
+
+func TestTwoQueuePolicy_promotes(t *testing.T) {
+	p := New2QPolicy(4).(*TwoQueuePolicy)
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		p.OnInsert(k)
+	}
+	if key, _ := p.Victim(); key != "a" {
+		t.Fatalf("expected a to be evicted but got %s", key)
+	}
+
+	// a is remembered, so inserting it again puts it in the main queue
+	// where it is not displaced by keys that are only used once.
+	p.OnInsert("a")
+	for _, k := range []string{"f", "g", "h"} {
+		p.OnInsert(k)
+		if key, _ := p.Victim(); key == "a" {
+			t.Fatal("expected a to be kept")
+		}
+	}
+}
+
+func TestCacheReplace_keepsPolicyHistory(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	evictions := []string{}
+	evictionCB := func(key yacache.Key, item yacache.Item) {
+		evictions = append(evictions, key.Value())
+	}
+
+	c := NewCache(WithMaxSize(2), WithPolicy(NewLFUPolicy()), WithEvictionHandler(evictionCB))
+
+	for i := 0; i < 3; i++ {
+		yacache.EnsureCacheGet(c, ctx, Key("a"), fetcher)
+	}
+	if err := c.(*Cache).Set(ctx, Key("a"), NewCacheableValue("replaced", 1*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	yacache.EnsureCacheGet(c, ctx, Key("b"), fetcher)
+	yacache.EnsureCacheGet(c, ctx, Key("c"), fetcher)
+
+	if fmt.Sprint(evictions) != "[b]" {
+		t.Fatalf("expected the replaced key to keep its frequency but got evictions %v", evictions)
+	}
+}
+
+// stuckPolicy is a policy that never has a victim in the cache.
+type stuckPolicy struct {
+	Policy
+	found bool
+}
+
+func (p *stuckPolicy) Victim() (string, bool) {
+	return "missing", p.found
+}
+
+func TestCacheEviction_stuckPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	for _, found := range []bool{false, true} {
+		c := NewCache(WithMaxSize(1), WithMaxCost(1), WithPolicy(&stuckPolicy{Policy: NewLRUPolicy(), found: found}))
+		yacache.EnsureCacheGet(c, ctx, Key("a"), fetcher)
+		yacache.EnsureCacheGet(c, ctx, Key("b"), fetcher)
+		if !yacache.EnsureCacheContains(c, ctx, Key("b")) {
+			t.Fatal("expected the cache to keep the items it could not evict")
+		}
+	}
+}
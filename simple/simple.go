@@ -16,8 +16,20 @@ type Item struct {
 	err      error
 	cached   time.Time
 	duration time.Duration
+
+	// first and window are the time the item was first cached and the
+	// duration it was first cached for, which are used to slide the item's
+	// expiration.
+	first  time.Time
+	window time.Duration
+
+	clock   yacache.Clock
+	version uint64
 }
 
+// ItemOption configures an Item.
+type ItemOption func(item *Item)
+
 // CacheableValue is a Cacheable structure for values (non-errors).
 type CacheableValue struct {
 	value    interface{}
@@ -30,25 +42,52 @@ type CacheableError struct {
 	duration time.Duration
 }
 
-// NewErrorItem returns an Item structure for a value (non-error), ensuring
-// it conforms to the yacache Item interface.
-func NewItem(value interface{}, cached time.Time, duration time.Duration) yacache.Item {
-	return Item{
+// NewItem returns an Item structure for a value (non-error), ensuring it
+// conforms to the yacache Item interface.
+func NewItem(value interface{}, cached time.Time, duration time.Duration, options ...ItemOption) yacache.Item {
+	item := Item{
 		value:    value,
 		err:      nil,
 		cached:   cached,
 		duration: duration,
+		first:    cached,
+		window:   duration,
+	}
+	for _, option := range options {
+		option(&item)
 	}
+	return item
 }
 
 // NewErrorItem returns an Item structure for an error, ensuring it conforms
 // to the yacache Item interface.
-func NewErrorItem(err error, cached time.Time, duration time.Duration) yacache.Item {
-	return Item{
+func NewErrorItem(err error, cached time.Time, duration time.Duration, options ...ItemOption) yacache.Item {
+	item := Item{
 		value:    nil,
 		err:      err,
 		cached:   cached,
 		duration: duration,
+		first:    cached,
+		window:   duration,
+	}
+	for _, option := range options {
+		option(&item)
+	}
+	return item
+}
+
+// WithItemClock configures the clock used to decide if an item has expired.
+// The system clock is used by default.
+func WithItemClock(clock yacache.Clock) ItemOption {
+	return func(item *Item) {
+		item.clock = clock
+	}
+}
+
+// WithItemVersion configures the version of an item.
+func WithItemVersion(version uint64) ItemOption {
+	return func(item *Item) {
+		item.version = version
 	}
 }
 
@@ -70,6 +109,36 @@ func NewCacheableError(err error, duration time.Duration) yacache.Cacheable {
 	}
 }
 
+// TaggedCacheable is a Cacheable that is stored with tags.
+type TaggedCacheable struct {
+	yacache.Cacheable
+	tags []string
+}
+
+// NewTaggedCacheable returns a Cacheable that is stored with tags, so that it
+// can be removed with the other items stored with one of its tags by caches
+// that implement yacache.TagInvalidator.
+func NewTaggedCacheable(cacheable yacache.Cacheable, tags ...string) yacache.Cacheable {
+	return TaggedCacheable{
+		Cacheable: cacheable,
+		tags:      tags,
+	}
+}
+
+// Tags returns the tags of the cacheable.
+func (c TaggedCacheable) Tags() []string {
+	return c.tags
+}
+
+// Cost returns the cost of the tagged cacheable, which is 1 unless it
+// implements yacache.Coster.
+func (c TaggedCacheable) Cost() int64 {
+	if coster, ok := c.Cacheable.(yacache.Coster); ok {
+		return coster.Cost()
+	}
+	return 1
+}
+
 func (i Item) Value() interface{} {
 	return i.value
 }
@@ -86,8 +155,41 @@ func (i Item) Duration() time.Duration {
 	return i.duration
 }
 
+// Version returns the version of the item, which is 0 unless it was set with
+// WithItemVersion.
+func (i Item) Version() uint64 {
+	return i.version
+}
+
 func (i Item) Expired() bool {
-	return time.Now().After(i.cached.Add(i.duration))
+	return i.now().After(i.cached.Add(i.duration))
+}
+
+func (i Item) now() time.Time {
+	if i.clock == nil {
+		return time.Now()
+	}
+	return i.clock.Now()
+}
+
+// Slide returns a copy of the item that was cached at now for its original
+// duration, but that expires no later than maxLifetime after it was first
+// cached. A maxLifetime of 0 does not limit the lifetime of the item.
+func (i Item) Slide(now time.Time, maxLifetime time.Duration) Item {
+	i.cached = now
+	i.duration = SlidingDuration(i.first, i.window, now, maxLifetime)
+	return i
+}
+
+// SlidingDuration returns the duration that an item first cached for window
+// should be cached for when it is refreshed at now, limited so that it
+// expires no later than maxLifetime after it was first cached.
+func SlidingDuration(first time.Time, window time.Duration, now time.Time, maxLifetime time.Duration) time.Duration {
+	deadline := now.Add(window)
+	if limit := first.Add(maxLifetime); maxLifetime > 0 && deadline.After(limit) {
+		deadline = limit
+	}
+	return deadline.Sub(now)
 }
 
 func (k Key) Value() string {
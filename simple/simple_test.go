@@ -2,8 +2,10 @@ package simple
 
 import (
 	"fmt"
+	"testing"
 	"time"
 
+	"github.com/ngerakines/yacache/cachetest"
 	"github.com/pkg/errors"
 )
 
@@ -53,3 +55,16 @@ func ExampleNewCacheableError() {
 	// failure
 	// 10m0s
 }
+
+func TestItemExpired(t *testing.T) {
+	clock := cachetest.NewFakeClock(time.Now())
+	i := NewItem("example", clock.Now(), 1*time.Minute, WithItemClock(clock))
+
+	if i.Expired() {
+		t.Fatal("item should not be expired")
+	}
+	clock.Advance(1*time.Minute + 1)
+	if !i.Expired() {
+		t.Fatal("item should be expired")
+	}
+}
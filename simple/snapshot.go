@@ -0,0 +1,219 @@
+package simple
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
+
+// Codec encodes and decodes the values of items in snapshots.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// GobCodec is a Codec that uses encoding/gob. Values of types other than the
+// basic types must be registered with gob.Register. It is the default codec.
+type GobCodec struct{}
+
+// JSONCodec is a Codec that uses encoding/json. Values are decoded into the
+// types that encoding/json uses for interface values, such as float64 for
+// numbers.
+type JSONCodec struct{}
+
+func (GobCodec) Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (JSONCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec) Decode(data []byte) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// snapshotFormat is the version of the snapshot format, which is written at
+// the start of each snapshot.
+const snapshotFormat = 1
+
+type snapshotHeader struct {
+	Format int
+}
+
+// snapshotEntry is an item in a snapshot. Times are Unix times in
+// nanoseconds.
+type snapshotEntry struct {
+	Key      string
+	Value    []byte
+	Error    string
+	HasError bool
+	Cached   int64
+	Duration time.Duration
+	First    int64
+	Window   time.Duration
+	Cost     int64
+}
+
+// Snapshot writes the items in the cache that have not expired to w, in the
+// order that they would be evicted, so that Restore recreates the order. The
+// values of items are encoded with the cache's codec.
+func (c *Cache) Snapshot(w io.Writer) error {
+	if err := c.lock.Acquire(context.Background(), 1); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
+
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(snapshotHeader{Format: snapshotFormat}); err != nil {
+		return err
+	}
+
+	for _, kv := range c.evictionOrder() {
+		if !c.live(kv) {
+			continue
+		}
+		entry, err := c.snapshotEntry(kv, c.values[kv])
+		if err != nil {
+			return fmt.Errorf("yacache: snapshot of %q: %w", kv, err)
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads items written by Snapshot from r and inserts them into the
+// cache, skipping items that have expired. Items already in the cache with
+// the same keys are replaced.
+func (c *Cache) Restore(r io.Reader) error {
+	if err := c.lock.Acquire(context.Background(), 1); err != nil {
+		return err
+	}
+	defer c.lock.Release(1)
+
+	decoder := gob.NewDecoder(r)
+	var header snapshotHeader
+	if err := decoder.Decode(&header); err != nil {
+		return err
+	}
+	if header.Format != snapshotFormat {
+		return fmt.Errorf("yacache: unsupported snapshot format %d", header.Format)
+	}
+
+	now := c.clock.Now()
+	for {
+		var entry snapshotEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		item, err := c.restoreItem(entry)
+		if err != nil {
+			return fmt.Errorf("yacache: restore of %q: %w", entry.Key, err)
+		}
+		if now.After(item.cached.Add(item.duration)) {
+			continue
+		}
+		c.insert(entry.Key, item, entry.Cost)
+	}
+}
+
+// evictionOrder returns the keys in the cache, starting with the next to be
+// evicted. Keys are ordered by when they were cached if the policy does not
+// implement OrderedPolicy.
+func (c *Cache) evictionOrder() []string {
+	if ordered, ok := c.policy.(OrderedPolicy); ok {
+		return ordered.Keys()
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for kv := range c.values {
+		keys = append(keys, kv)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return c.values[keys[i]].Cached().Before(c.values[keys[j]].Cached())
+	})
+	return keys
+}
+
+func (c *Cache) snapshotEntry(kv string, item yacache.Item) (snapshotEntry, error) {
+	entry := snapshotEntry{
+		Key:      kv,
+		Cached:   item.Cached().UnixNano(),
+		Duration: item.Duration(),
+		First:    item.Cached().UnixNano(),
+		Window:   item.Duration(),
+		Cost:     c.costs[kv],
+	}
+	if simpleItem, ok := item.(Item); ok {
+		entry.First = simpleItem.first.UnixNano()
+		entry.Window = simpleItem.window
+	}
+
+	if err := item.Error(); err != nil {
+		entry.HasError = true
+		entry.Error = err.Error()
+		return entry, nil
+	}
+
+	value, err := c.codec.Encode(item.Value())
+	if err != nil {
+		return snapshotEntry{}, err
+	}
+	entry.Value = value
+	return entry, nil
+}
+
+func (c *Cache) restoreItem(entry snapshotEntry) (Item, error) {
+	c.version++
+	item := Item{
+		cached:   time.Unix(0, entry.Cached),
+		duration: entry.Duration,
+		first:    time.Unix(0, entry.First),
+		window:   entry.Window,
+		clock:    c.clock,
+		version:  c.version,
+	}
+
+	if entry.HasError {
+		item.err = errors.New(entry.Error)
+		return item, nil
+	}
+
+	value, err := c.codec.Decode(entry.Value)
+	if err != nil {
+		return Item{}, err
+	}
+	item.value = value
+	return item, nil
+}
@@ -0,0 +1,111 @@
+package simple
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+	"github.com/ngerakines/yacache/cachetest"
+)
+
+type snapshotValue struct {
+	Name  string
+	Count int
+}
+
+func init() {
+	gob.Register(snapshotValue{})
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	c := NewCache(WithMaxSize(4), WithClock(clock)).(*Cache)
+	yacache.EnsureCacheSet(c, ctx, Key("a"), NewCacheableValue(snapshotValue{Name: "a", Count: 1}, time.Hour))
+	yacache.EnsureCacheSet(c, ctx, Key("b"), NewCacheableValue("b", time.Hour))
+	yacache.EnsureCacheSet(c, ctx, Key("c"), NewCacheableError(errors.New("c failed"), time.Hour))
+	yacache.EnsureCacheSet(c, ctx, Key("short"), NewCacheableValue("short", time.Minute))
+	clock.Advance(30 * time.Second)
+	yacache.EnsureCacheGet(c, ctx, Key("a"), nil)
+
+	var buf bytes.Buffer
+	if err := c.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Minute)
+	restored := NewCache(WithMaxSize(4), WithClock(clock)).(*Cache)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, _ := restored.Len(ctx); size != 3 {
+		t.Fatalf("expected the expired item to be skipped, got %d items", size)
+	}
+
+	item, ok, _ := restored.Peek(ctx, Key("a"))
+	if !ok || item.Value() != (snapshotValue{Name: "a", Count: 1}) {
+		t.Fatalf("unexpected item for a: %v", item)
+	}
+	if original, _, _ := c.Peek(ctx, Key("a")); !item.Cached().Equal(original.Cached()) || item.Duration() != original.Duration() {
+		t.Fatalf("expected the cached time and duration to be kept, got %v", item)
+	}
+	item, ok, _ = restored.Peek(ctx, Key("c"))
+	if !ok || item.Error() == nil || item.Error().Error() != "c failed" {
+		t.Fatalf("unexpected item for c: %v", item)
+	}
+
+	// The eviction order is kept: b, then c, then a.
+	yacache.EnsureCacheSet(restored, ctx, Key("d"), NewCacheableValue("d", time.Hour))
+	yacache.EnsureCacheSet(restored, ctx, Key("e"), NewCacheableValue("e", time.Hour))
+	for key, expected := range map[string]bool{"a": true, "b": false, "c": true, "d": true, "e": true} {
+		if _, ok, _ := restored.Peek(ctx, Key(key)); ok != expected {
+			t.Errorf("expected %s to be cached: %v", key, expected)
+		}
+	}
+	yacache.EnsureCacheSet(restored, ctx, Key("f"), NewCacheableValue("f", time.Hour))
+	if _, ok, _ := restored.Peek(ctx, Key("c")); ok {
+		t.Error("expected c to be evicted before a")
+	}
+}
+
+func TestCacheSnapshot_jsonCodec(t *testing.T) {
+	ctx := context.Background()
+
+	c := NewCache(WithCodec(JSONCodec{})).(*Cache)
+	yacache.EnsureCacheSet(c, ctx, Key("foo"), NewCacheableValue(map[string]interface{}{"bar": "baz"}, time.Hour))
+
+	var buf bytes.Buffer
+	if err := c.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCache(WithCodec(JSONCodec{})).(*Cache)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	item, ok, _ := restored.Peek(ctx, Key("foo"))
+	if !ok || item.Value().(map[string]interface{})["bar"] != "baz" {
+		t.Fatalf("unexpected item: %v", item)
+	}
+}
+
+func TestCacheRestore_invalid(t *testing.T) {
+	c := NewCache().(*Cache)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshotHeader{Format: 99}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Restore(&buf); err == nil {
+		t.Fatal("expected an unsupported format to be an error")
+	}
+	if err := c.Restore(bytes.NewReader([]byte("nope"))); err == nil {
+		t.Fatal("expected an invalid snapshot to be an error")
+	}
+}
@@ -0,0 +1,266 @@
+package simple
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCount   = 15
+	sketchMinWidth   = 16
+	sketchResetRatio = 10
+)
+
+// sketch is a count-min sketch that estimates how frequently keys have been
+// seen. Counters saturate at 15 and are halved periodically so that the
+// estimates favor recent history.
+type sketch struct {
+	counters  [sketchDepth][]uint8
+	mask      uint32
+	additions int
+	resetAt   int
+}
+
+func newSketch(capacity int) *sketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width *= 2
+	}
+
+	s := &sketch{
+		mask:    uint32(width - 1),
+		resetAt: width * sketchResetRatio,
+	}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *sketch) increment(key string) {
+	h1, h2 := sketchHash(key)
+	for i := range s.counters {
+		idx := (h1 + uint32(i)*h2) & s.mask
+		if s.counters[i][idx] < sketchMaxCount {
+			s.counters[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := sketchHash(key)
+	min := uint8(sketchMaxCount)
+	for i := range s.counters {
+		idx := (h1 + uint32(i)*h2) & s.mask
+		if s.counters[i][idx] < min {
+			min = s.counters[i][idx]
+		}
+	}
+	return min
+}
+
+func (s *sketch) reset() {
+	for i := range s.counters {
+		for j := range s.counters[i] {
+			s.counters[i][j] /= 2
+		}
+	}
+	s.additions /= 2
+}
+
+func sketchHash(key string) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+type tinyLFUSegment int8
+
+const (
+	windowSegment tinyLFUSegment = iota
+	probationSegment
+	protectedSegment
+)
+
+type tinyLFUEntry struct {
+	key     string
+	segment tinyLFUSegment
+}
+
+// TinyLFUPolicy is a W-TinyLFU policy. New keys enter a small LRU window and must
+// be estimated to be used more frequently than the main segmented LRU's
+// victim to be admitted into it, which keeps one-off keys from flushing
+// frequently used keys out of the cache.
+type TinyLFUPolicy struct {
+	sketch *sketch
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	entries   map[string]*list.Element
+
+	windowCapacity    int
+	mainCapacity      int
+	protectedCapacity int
+}
+
+// NewTinyLFUPolicy returns a W-TinyLFU policy for a cache that holds up to
+// capacity keys.
+func NewTinyLFUPolicy(capacity int) Policy {
+	p := &TinyLFUPolicy{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		entries:   make(map[string]*list.Element),
+	}
+	p.resize(capacity)
+	return p
+}
+
+// resize changes the number of keys that the policy is sized for. The sketch
+// is only replaced when the capacity outgrows it, so that the estimates are
+// kept while the capacity settles.
+func (p *TinyLFUPolicy) resize(capacity int) {
+	if capacity < 2 {
+		capacity = 2
+	}
+	if capacity == p.windowCapacity+p.mainCapacity {
+		return
+	}
+
+	p.windowCapacity = capacity / 100
+	if p.windowCapacity < 1 {
+		p.windowCapacity = 1
+	}
+	p.mainCapacity = capacity - p.windowCapacity
+	p.protectedCapacity = p.mainCapacity * 8 / 10
+
+	if p.sketch == nil || int(p.sketch.mask) < capacity-1 {
+		p.sketch = newSketch(capacity)
+	}
+
+	for p.protected.Len() > p.protectedCapacity {
+		p.demote()
+	}
+	p.admitWindow()
+}
+
+func (p *TinyLFUPolicy) OnAccess(key string) {
+	p.sketch.increment(key)
+
+	e, ok := p.entries[key]
+	if !ok {
+		return
+	}
+
+	entry := e.Value.(*tinyLFUEntry)
+	switch entry.segment {
+	case windowSegment:
+		p.window.MoveToFront(e)
+	case probationSegment:
+		p.probation.Remove(e)
+		entry.segment = protectedSegment
+		p.entries[key] = p.protected.PushFront(entry)
+		if p.protected.Len() > p.protectedCapacity {
+			p.demote()
+		}
+	case protectedSegment:
+		p.protected.MoveToFront(e)
+	}
+}
+
+func (p *TinyLFUPolicy) OnInsert(key string) {
+	if _, ok := p.entries[key]; ok {
+		p.OnAccess(key)
+		return
+	}
+
+	p.sketch.increment(key)
+	p.entries[key] = p.window.PushFront(&tinyLFUEntry{key: key, segment: windowSegment})
+	p.admitWindow()
+}
+
+func (p *TinyLFUPolicy) OnRemove(key string) {
+	e, ok := p.entries[key]
+	if !ok {
+		return
+	}
+	p.segment(e).Remove(e)
+	delete(p.entries, key)
+}
+
+func (p *TinyLFUPolicy) Victim() (string, bool) {
+	mainVictim := p.probation.Back()
+	if mainVictim == nil {
+		mainVictim = p.protected.Back()
+	}
+	candidate := p.window.Back()
+
+	switch {
+	case candidate == nil && mainVictim == nil:
+		return "", false
+	case mainVictim == nil:
+		return p.evict(candidate), true
+	case candidate == nil || p.window.Len() <= p.windowCapacity:
+		return p.evict(mainVictim), true
+	}
+
+	// The window is over capacity, so its least recently used key competes
+	// with the main segment's victim for a place in the cache.
+	candidateKey := candidate.Value.(*tinyLFUEntry).key
+	victimKey := mainVictim.Value.(*tinyLFUEntry).key
+	if p.sketch.estimate(candidateKey) <= p.sketch.estimate(victimKey) {
+		return p.evict(candidate), true
+	}
+
+	key := p.evict(mainVictim)
+	entry := p.window.Remove(candidate).(*tinyLFUEntry)
+	entry.segment = probationSegment
+	p.entries[entry.key] = p.probation.PushFront(entry)
+	return key, true
+}
+
+// admitWindow moves the keys beyond the window's capacity into the main
+// segment without competing until the main segment is full.
+func (p *TinyLFUPolicy) admitWindow() {
+	for p.window.Len() > p.windowCapacity && p.mainLen() < p.mainCapacity {
+		entry := p.window.Remove(p.window.Back()).(*tinyLFUEntry)
+		entry.segment = probationSegment
+		p.entries[entry.key] = p.probation.PushFront(entry)
+	}
+}
+
+// demote moves the least recently used protected key to probation.
+func (p *TinyLFUPolicy) demote() {
+	demoted := p.protected.Remove(p.protected.Back()).(*tinyLFUEntry)
+	demoted.segment = probationSegment
+	p.entries[demoted.key] = p.probation.PushFront(demoted)
+}
+
+func (p *TinyLFUPolicy) evict(e *list.Element) string {
+	entry := p.segment(e).Remove(e).(*tinyLFUEntry)
+	delete(p.entries, entry.key)
+	return entry.key
+}
+
+func (p *TinyLFUPolicy) segment(e *list.Element) *list.List {
+	switch e.Value.(*tinyLFUEntry).segment {
+	case probationSegment:
+		return p.probation
+	case protectedSegment:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+func (p *TinyLFUPolicy) mainLen() int {
+	return p.probation.Len() + p.protected.Len()
+}
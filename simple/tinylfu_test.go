@@ -0,0 +1,105 @@
+package simple
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ngerakines/yacache"
+)
+
+func TestSketch(t *testing.T) {
+	s := newSketch(64)
+
+	for i := 0; i < 5; i++ {
+		s.increment("hot")
+	}
+	s.increment("warm")
+
+	if e := s.estimate("hot"); e != 5 {
+		t.Fatalf("expected hot estimate to be 5 but got %d", e)
+	}
+	if e := s.estimate("warm"); e != 1 {
+		t.Fatalf("expected warm estimate to be 1 but got %d", e)
+	}
+	if e := s.estimate("cold"); e != 0 {
+		t.Fatalf("expected cold estimate to be 0 but got %d", e)
+	}
+
+	for i := 0; i < 100; i++ {
+		s.increment("hot")
+	}
+	if e := s.estimate("hot"); e != sketchMaxCount {
+		t.Fatalf("expected hot estimate to saturate at %d but got %d", sketchMaxCount, e)
+	}
+
+	s.reset()
+	if e := s.estimate("hot"); e != sketchMaxCount/2 {
+		t.Fatalf("expected hot estimate to be halved to %d but got %d", sketchMaxCount/2, e)
+	}
+}
+
+// scanWorkload returns a trace where half of the requests are for a small set
+// of hot keys and the other half are for keys that are never seen again.
+func scanWorkload(requests, hotKeys int) []string {
+	r := rand.New(rand.NewSource(1))
+	trace := make([]string, requests)
+	for i := range trace {
+		if r.Intn(2) == 0 {
+			trace[i] = fmt.Sprintf("hot-%d", r.Intn(hotKeys))
+		} else {
+			trace[i] = fmt.Sprintf("scan-%d", i)
+		}
+	}
+	return trace
+}
+
+func hitRatio(t *testing.T, c yacache.Cache, trace []string) float64 {
+	t.Helper()
+
+	ctx := context.Background()
+	misses := 0
+	fetcher := func(ctx context.Context, fkey yacache.Key) (yacache.Cacheable, error) {
+		misses++
+		return NewCacheableValue("value", 1*time.Hour), nil
+	}
+
+	for _, k := range trace {
+		if _, err := c.Get(ctx, Key(k), fetcher); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return float64(len(trace)-misses) / float64(len(trace))
+}
+
+func TestCacheTinyLFU_hitRatio(t *testing.T) {
+	trace := scanWorkload(100000, 80)
+
+	lruRatio := hitRatio(t, NewCache(WithMaxSize(100)), trace)
+	tinyLFURatio := hitRatio(t, NewCache(WithMaxSize(100), WithTinyLFU()), trace)
+
+	t.Logf("lru hit ratio %.3f, tinylfu hit ratio %.3f", lruRatio, tinyLFURatio)
+	if tinyLFURatio < lruRatio+0.1 {
+		t.Fatalf("expected tinylfu hit ratio %.3f to be well above lru hit ratio %.3f", tinyLFURatio, lruRatio)
+	}
+}
+
+func TestCacheTinyLFU_maxCost(t *testing.T) {
+	trace := scanWorkload(100000, 80)
+
+	c := NewCache(WithMaxCost(100), WithTinyLFU())
+	lruRatio := hitRatio(t, NewCache(WithMaxCost(100)), trace)
+	tinyLFURatio := hitRatio(t, c, trace)
+
+	policy := c.(*Cache).policy.(*TinyLFUPolicy)
+	if capacity := policy.windowCapacity + policy.mainCapacity; capacity != 100 {
+		t.Fatalf("expected the policy to be sized to 100 items but got %d", capacity)
+	}
+
+	t.Logf("lru hit ratio %.3f, tinylfu hit ratio %.3f", lruRatio, tinyLFURatio)
+	if tinyLFURatio < lruRatio+0.1 {
+		t.Fatalf("expected tinylfu hit ratio %.3f to be well above lru hit ratio %.3f", tinyLFURatio, lruRatio)
+	}
+}
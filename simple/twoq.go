@@ -0,0 +1,102 @@
+package simple
+
+import "container/list"
+
+// TwoQueuePolicy is a 2Q eviction policy. Keys are first held in a FIFO queue
+// (a1in) and only promoted to the main LRU queue (am) if they are inserted
+// again shortly after being evicted from it, while they are remembered in
+// a1out. This keeps keys that are used once from displacing keys in am.
+type TwoQueuePolicy struct {
+	inCapacity  int
+	outCapacity int
+
+	a1in  *list.List
+	a1out *list.List
+	am    *list.List
+
+	entries map[string]*list.Element
+	lists   map[string]*list.List
+}
+
+// New2QPolicy returns a 2Q eviction policy for a cache that holds up to
+// capacity keys. A quarter of the capacity is used for a1in and keys evicted
+// from it are remembered for half of the capacity.
+func New2QPolicy(capacity int) Policy {
+	inCapacity := capacity / 4
+	if inCapacity < 1 {
+		inCapacity = 1
+	}
+	outCapacity := capacity / 2
+	if outCapacity < 1 {
+		outCapacity = 1
+	}
+
+	return &TwoQueuePolicy{
+		inCapacity:  inCapacity,
+		outCapacity: outCapacity,
+		a1in:        list.New(),
+		a1out:       list.New(),
+		am:          list.New(),
+		entries:     make(map[string]*list.Element),
+		lists:       make(map[string]*list.List),
+	}
+}
+
+func (p *TwoQueuePolicy) OnAccess(key string) {
+	if p.lists[key] == p.am {
+		p.am.MoveToFront(p.entries[key])
+	}
+}
+
+func (p *TwoQueuePolicy) OnInsert(key string) {
+	switch p.lists[key] {
+	case p.am:
+		p.am.MoveToFront(p.entries[key])
+	case p.a1in:
+	case p.a1out:
+		p.move(key, p.am)
+	default:
+		p.move(key, p.a1in)
+	}
+}
+
+func (p *TwoQueuePolicy) OnRemove(key string) {
+	switch p.lists[key] {
+	case p.a1in, p.am:
+		p.forget(key)
+	}
+}
+
+func (p *TwoQueuePolicy) Victim() (string, bool) {
+	if p.a1in.Len() > 0 && (p.a1in.Len() > p.inCapacity || p.am.Len() == 0) {
+		key := p.a1in.Back().Value.(string)
+		p.move(key, p.a1out)
+		for p.a1out.Len() > p.outCapacity {
+			p.forget(p.a1out.Back().Value.(string))
+		}
+		return key, true
+	}
+
+	if p.am.Len() > 0 {
+		key := p.am.Back().Value.(string)
+		p.forget(key)
+		return key, true
+	}
+
+	return "", false
+}
+
+// move puts a key at the front of a queue.
+func (p *TwoQueuePolicy) move(key string, to *list.List) {
+	p.forget(key)
+	p.entries[key] = to.PushFront(key)
+	p.lists[key] = to
+}
+
+func (p *TwoQueuePolicy) forget(key string) {
+	if l, ok := p.lists[key]; ok {
+		l.Remove(p.entries[key])
+		delete(p.entries, key)
+		delete(p.lists, key)
+	}
+}
@@ -0,0 +1,238 @@
+package yacache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BatchFetcher fetches the cacheables for several keys at once, returning
+// them by the value of their keys. Keys that are missing from the result are
+// reported as ErrNotFetched.
+type BatchFetcher func(ctx context.Context, keys []Key) (map[string]Cacheable, error)
+
+// ErrNotFetched is the error recorded by WarmBatch for keys that the batch
+// fetcher did not return a cacheable for.
+var ErrNotFetched = errors.New("yacache: key was not fetched")
+
+// WarmProgress is the progress of warming a cache, which is given to the
+// callback configured with WithWarmProgress.
+type WarmProgress struct {
+	// Completed is the number of keys that have been warmed or have failed.
+	Completed int
+
+	// Failed is the number of keys that could not be warmed.
+	Failed int
+
+	// Total is the number of keys to warm.
+	Total int
+}
+
+// WarmError is returned by Warm and WarmBatch when some of the keys could not
+// be warmed. The other keys are still cached.
+type WarmError struct {
+	// Errors holds the error for each key that could not be warmed, by the
+	// value of the key.
+	Errors map[string]error
+}
+
+func (e *WarmError) Error() string {
+	return fmt.Sprintf("yacache: failed to warm %d keys", len(e.Errors))
+}
+
+// Unwrap returns the errors for the keys that could not be warmed, ordered by
+// key.
+func (e *WarmError) Unwrap() []error {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = e.Errors[key]
+	}
+	return errs
+}
+
+// WarmOption configures Warm and WarmBatch.
+type WarmOption func(config *warmConfig)
+
+type warmConfig struct {
+	interval  time.Duration
+	batchSize int
+	progress  func(WarmProgress)
+}
+
+// WithWarmInterval limits the rate of fetches to one every interval. For
+// WarmBatch, it limits the rate of batches.
+func WithWarmInterval(interval time.Duration) WarmOption {
+	return func(config *warmConfig) {
+		config.interval = interval
+	}
+}
+
+// WithWarmBatchSize configures the number of keys given to the fetcher by
+// WarmBatch. The default batch size is 100.
+func WithWarmBatchSize(size int) WarmOption {
+	return func(config *warmConfig) {
+		config.batchSize = size
+	}
+}
+
+// WithWarmProgress configures a callback that is called each time a key, or
+// a batch of keys, has been warmed. Calls are not made concurrently.
+func WithWarmProgress(callback func(WarmProgress)) WarmOption {
+	return func(config *warmConfig) {
+		config.progress = callback
+	}
+}
+
+// Warm populates a cache with the items for keys, fetching up to concurrency
+// keys at once. Keys that are already cached are not fetched again. Keys that
+// could not be warmed do not stop the others from being warmed, and are
+// returned in a *WarmError. If the context is done, no more keys are fetched
+// and its error is returned.
+func Warm(ctx context.Context, cache Cache, keys []Key, fetcher Fetcher, concurrency int, options ...WarmOption) error {
+	config := newWarmConfig(options)
+	config.batchSize = 1
+
+	return warm(ctx, keys, concurrency, config, func(ctx context.Context, batch []Key) map[string]error {
+		if _, err := cache.Get(ctx, batch[0], fetcher); err != nil {
+			return map[string]error{batch[0].Value(): err}
+		}
+		return nil
+	})
+}
+
+// WarmBatch is like Warm, but fetches the keys that are not already cached in
+// batches. Up to concurrency batches are fetched at once. Fetched items are
+// stored with Set if the cache implements Setter, and with Put otherwise.
+func WarmBatch(ctx context.Context, cache Cache, keys []Key, fetcher BatchFetcher, concurrency int, options ...WarmOption) error {
+	config := newWarmConfig(options)
+
+	return warm(ctx, keys, concurrency, config, func(ctx context.Context, batch []Key) map[string]error {
+		errs := make(map[string]error)
+
+		var missing []Key
+		for _, key := range batch {
+			if ok, err := cache.Contains(ctx, key); err != nil {
+				errs[key.Value()] = err
+			} else if !ok {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) == 0 {
+			return errs
+		}
+
+		fetched, err := fetcher(ctx, missing)
+		if err != nil {
+			for _, key := range missing {
+				errs[key.Value()] = err
+			}
+			return errs
+		}
+
+		for _, key := range missing {
+			cacheable, ok := fetched[key.Value()]
+			if !ok {
+				errs[key.Value()] = ErrNotFetched
+				continue
+			}
+			if err := Set(ctx, cache, key, cacheable); err != nil {
+				errs[key.Value()] = err
+			}
+		}
+		return errs
+	})
+}
+
+func newWarmConfig(options []WarmOption) warmConfig {
+	config := warmConfig{batchSize: 100}
+	for _, option := range options {
+		option(&config)
+	}
+	if config.batchSize < 1 {
+		config.batchSize = 1
+	}
+	return config
+}
+
+// warm splits keys into batches and gives them to concurrency workers,
+// collecting the errors that they return for each key.
+func warm(ctx context.Context, keys []Key, concurrency int, config warmConfig, work func(ctx context.Context, batch []Key) map[string]error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var limit <-chan time.Time
+	if config.interval > 0 {
+		ticker := time.NewTicker(config.interval)
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		errs     = make(map[string]error)
+		progress = WarmProgress{Total: len(keys)}
+		batches  = make(chan []Key)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				failed := work(ctx, batch)
+
+				mu.Lock()
+				for key, err := range failed {
+					errs[key] = err
+				}
+				progress.Completed += len(batch)
+				progress.Failed = len(errs)
+				if config.progress != nil {
+					config.progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for start := 0; start < len(keys); start += config.batchSize {
+		if limit != nil && start > 0 {
+			select {
+			case <-limit:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+
+		end := start + config.batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		select {
+		case batches <- keys[start:end]:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return &WarmError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+package yacache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type warmKey string
+
+func (k warmKey) Value() string {
+	return string(k)
+}
+
+type warmCacheable string
+
+func (c warmCacheable) Value() interface{} {
+	return string(c)
+}
+
+func (c warmCacheable) Error() error {
+	return nil
+}
+
+func (c warmCacheable) Duration() time.Duration {
+	return time.Hour
+}
+
+// mapCache is a cache that stores cacheables in a map, without expiring them.
+type mapCache struct {
+	mu     sync.Mutex
+	values map[string]Cacheable
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{values: make(map[string]Cacheable)}
+}
+
+func (c *mapCache) Get(ctx context.Context, key Key, fetcher Fetcher) (Item, error) {
+	c.mu.Lock()
+	cacheable, ok := c.values[key.Value()]
+	c.mu.Unlock()
+	if ok {
+		return nil, nil
+	}
+
+	cacheable, err := fetcher(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key.Value()] = cacheable
+	return nil, nil
+}
+
+func (c *mapCache) Put(ctx context.Context, key Key, fetcher Fetcher) error {
+	cacheable, err := fetcher(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key.Value()] = cacheable
+	return nil
+}
+
+func (c *mapCache) Contains(ctx context.Context, key Key) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.values[key.Value()]
+	return ok, nil
+}
+
+func (c *mapCache) Delete(ctx context.Context, key Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key.Value())
+	return nil
+}
+
+func warmKeys(count int) []Key {
+	keys := make([]Key, count)
+	for i := range keys {
+		keys[i] = warmKey(fmt.Sprintf("key%d", i))
+	}
+	return keys
+}
+
+func TestWarm(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+	cache.values["key0"] = warmCacheable("cached")
+
+	var running, maxRunning atomic.Int32
+	errFailed := errors.New("failed")
+	fetcher := func(ctx context.Context, key Key) (Cacheable, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := maxRunning.Load()
+			if n <= current || maxRunning.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		if key.Value() == "key3" {
+			return nil, errFailed
+		}
+		return warmCacheable("fetched"), nil
+	}
+
+	var last WarmProgress
+	calls := 0
+	err := Warm(ctx, cache, warmKeys(20), fetcher, 4, WithWarmProgress(func(progress WarmProgress) {
+		calls++
+		last = progress
+	}))
+
+	var warmErr *WarmError
+	if !errors.As(err, &warmErr) || len(warmErr.Errors) != 1 || warmErr.Errors["key3"] != errFailed {
+		t.Fatalf("expected the error for key3 but got %v", err)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Fatal("expected the warm error to wrap the key's error")
+	}
+	if maxRunning.Load() > 4 {
+		t.Fatalf("expected at most 4 concurrent fetches but got %d", maxRunning.Load())
+	}
+	if calls != 20 || last != (WarmProgress{Completed: 20, Failed: 1, Total: 20}) {
+		t.Fatalf("unexpected progress after %d calls: %+v", calls, last)
+	}
+	if cache.values["key0"] != warmCacheable("cached") {
+		t.Fatal("expected a cached key not to be fetched again")
+	}
+	if len(cache.values) != 19 {
+		t.Fatalf("expected 19 keys to be cached but got %d", len(cache.values))
+	}
+}
+
+func TestWarmInterval(t *testing.T) {
+	start := time.Now()
+	fetcher := func(ctx context.Context, key Key) (Cacheable, error) {
+		return warmCacheable("fetched"), nil
+	}
+
+	if err := Warm(context.Background(), newMapCache(), warmKeys(5), fetcher, 5, WithWarmInterval(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected fetches to be rate limited but they took %s", elapsed)
+	}
+}
+
+func TestWarmCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cache := newMapCache()
+
+	fetcher := func(ctx context.Context, key Key) (Cacheable, error) {
+		if key.Value() == "key2" {
+			cancel()
+		}
+		return warmCacheable("fetched"), nil
+	}
+
+	err := Warm(ctx, cache, warmKeys(100), fetcher, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the context's error but got %v", err)
+	}
+	if len(cache.values) == 100 {
+		t.Fatal("expected warming to stop when the context is cancelled")
+	}
+}
+
+func TestWarmBatch(t *testing.T) {
+	ctx := context.Background()
+	cache := newMapCache()
+	cache.values["key0"] = warmCacheable("cached")
+
+	var mu sync.Mutex
+	var batches [][]Key
+	fetcher := func(ctx context.Context, keys []Key) (map[string]Cacheable, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+
+		fetched := make(map[string]Cacheable)
+		for _, key := range keys {
+			if key.Value() != "key5" {
+				fetched[key.Value()] = warmCacheable("fetched")
+			}
+		}
+		return fetched, nil
+	}
+
+	var last WarmProgress
+	err := WarmBatch(ctx, cache, warmKeys(10), fetcher, 2, WithWarmBatchSize(4), WithWarmProgress(func(progress WarmProgress) {
+		last = progress
+	}))
+
+	var warmErr *WarmError
+	if !errors.As(err, &warmErr) || len(warmErr.Errors) != 1 || warmErr.Errors["key5"] != ErrNotFetched {
+		t.Fatalf("expected key5 not to be fetched but got %v", err)
+	}
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches but got %d", len(batches))
+	}
+	for _, batch := range batches {
+		for _, key := range batch {
+			if key.Value() == "key0" {
+				t.Fatal("expected a cached key not to be fetched again")
+			}
+		}
+	}
+	if last != (WarmProgress{Completed: 10, Failed: 1, Total: 10}) {
+		t.Fatalf("unexpected progress: %+v", last)
+	}
+	if len(cache.values) != 9 {
+		t.Fatalf("expected 9 keys to be cached but got %d", len(cache.values))
+	}
+}
+
+func TestWarmBatchFetcherError(t *testing.T) {
+	errFailed := errors.New("failed")
+	fetcher := func(ctx context.Context, keys []Key) (map[string]Cacheable, error) {
+		return nil, errFailed
+	}
+
+	err := WarmBatch(context.Background(), newMapCache(), warmKeys(3), fetcher, 1)
+
+	var warmErr *WarmError
+	if !errors.As(err, &warmErr) || len(warmErr.Errors) != 3 {
+		t.Fatalf("expected an error for each key but got %v", err)
+	}
+}
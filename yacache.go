@@ -48,8 +48,97 @@ type Cacheable interface {
 	Duration() time.Duration
 }
 
+// Coster is implemented by a Cacheable that knows the cost, such as the size
+// in bytes, of keeping it in a cache.
+type Coster interface {
+	// Cost returns the cost of keeping the value in the cache.
+	Cost() int64
+}
+
+// Tagger is implemented by a Cacheable that is stored with tags, so that the
+// items stored with a tag can be removed together.
+type Tagger interface {
+	// Tags returns the tags of the cacheable.
+	Tags() []string
+}
+
+// TagInvalidator is implemented by caches that can remove every item stored
+// with a tag.
+type TagInvalidator interface {
+	// InvalidateTag removes the items stored with a tag, returning the
+	// number of items removed.
+	InvalidateTag(ctx context.Context, tag string) (int, error)
+}
+
+// Clock tells the time. Caches use a Clock to record when data was cached and
+// to decide if it has expired.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock that uses the system time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Stats are counters that describe how a cache has been used.
+type Stats struct {
+	// Hits is the number of times data was returned from the cache.
+	Hits uint64
+
+	// Misses is the number of times data had to be fetched.
+	Misses uint64
+
+	// Evictions is the number of items removed to make room for others.
+	Evictions uint64
+
+	// Expirations is the number of items removed because they expired.
+	Expirations uint64
+}
+
+// StatsReporter is implemented by caches that count how they have been used.
+type StatsReporter interface {
+	Stats() Stats
+}
+
 // Fetcher returns data to be used to populate a cache.
 type Fetcher func(ctx context.Context, key Key) (Cacheable, error)
 
 // EvictionCallback is a function that is called when data is removed from the cache.
 type EvictionCallback func(key Key, item Item)
+
+// Setter is implemented by caches that can store a value directly, without a
+// Fetcher.
+type Setter interface {
+	// Set stores a cacheable for a key, replacing any item already cached
+	// for the key.
+	Set(ctx context.Context, key Key, cacheable Cacheable) error
+}
+
+// Versioned is implemented by items that have a version. The version changes
+// each time an item is stored for a key, and is used to make conditional
+// writes.
+type Versioned interface {
+	Version() uint64
+}
+
+// ConditionalWriter is implemented by caches that can change items only when
+// they are in an expected state, so that writers in different goroutines or
+// processes do not overwrite each other's changes.
+type ConditionalWriter interface {
+	// SetIfAbsent stores a cacheable if no item is cached for the key. It
+	// returns true if the cacheable was stored.
+	SetIfAbsent(ctx context.Context, key Key, cacheable Cacheable) (bool, error)
+
+	// SetIfVersion stores a cacheable if the item cached for the key has
+	// the version. It returns true if the cacheable was stored.
+	SetIfVersion(ctx context.Context, key Key, cacheable Cacheable, version uint64) (bool, error)
+
+	// DeleteIfVersion removes the item cached for the key if it has the
+	// version. It returns true if the item was removed.
+	DeleteIfVersion(ctx context.Context, key Key, version uint64) (bool, error)
+}